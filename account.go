@@ -0,0 +1,245 @@
+package pindb
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tmstn/pinboard"
+)
+
+// account is what the stores of one Pinboard account share: the rate
+// limiter for calls to the backend and, while RefreshAll runs, the time of
+// the last change to its posts.
+type account struct {
+	mu       sync.Mutex
+	username string
+	limits   limits
+	next     time.Time
+	after    map[string]time.Time
+	sharing  int
+	update   *time.Time
+	updating sync.Mutex
+}
+
+// wait blocks until the account may call endpoint or ctx is done. Calls are
+// spaced by the limits of the account in the order they asked.
+func (a *account) wait(ctx context.Context, endpoint string) error {
+	err := ctx.Err()
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	now := time.Now()
+	at := a.next
+	if after := a.after[endpoint]; at.Before(after) {
+		at = after
+	}
+	if at.Before(now) {
+		at = now
+	}
+	a.next = at.Add(a.limits.interval)
+	if d := a.limits.spacing(endpoint); d > 0 {
+		if a.after == nil {
+			a.after = map[string]time.Time{}
+		}
+		a.after[endpoint] = at.Add(d)
+	}
+	a.mu.Unlock()
+
+	d := time.Until(at)
+	if d <= 0 {
+		return nil
+	}
+
+	a.limits.logf("waiting %s before %s for %s", d.Round(time.Millisecond), endpoint, a.username)
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// hold keeps every call of the account waiting for at least d, as Pinboard
+// asks after answering 429.
+func (a *account) hold(d time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	until := time.Now().Add(d)
+	if a.next.Before(until) {
+		a.next = until
+	}
+}
+
+// share caches the time of the last change to the posts until a matching
+// unshare, so that refreshing many stores and buckets asks for it once.
+func (a *account) share() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.sharing++
+}
+
+func (a *account) unshare() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.sharing--
+	if a.sharing == 0 {
+		a.update = nil
+	}
+}
+
+// forget drops the cached update time after a change to the posts.
+func (a *account) forget() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.update = nil
+}
+
+func (a *account) lastUpdate(fetch func() (time.Time, error)) (time.Time, error) {
+	a.updating.Lock()
+	defer a.updating.Unlock()
+
+	a.mu.Lock()
+	shared, cached := a.sharing > 0, a.update
+	a.mu.Unlock()
+
+	if shared && cached != nil {
+		return *cached, nil
+	}
+
+	t, err := fetch()
+	if err != nil {
+		return t, err
+	}
+
+	a.mu.Lock()
+	if a.sharing > 0 {
+		a.update = &t
+	}
+	a.mu.Unlock()
+	return t, nil
+}
+
+type accounts map[string]*account
+
+// get returns the account of the token, adding it with limits when it is
+// not known.
+func (a *accounts) get(token string, limits limits) *account {
+	username := strings.SplitN(token, ":", 2)[0]
+	v, ok := (*a)[username]
+	if !ok {
+		v = &account{username: username, limits: limits}
+		(*a)[username] = v
+	}
+	return v
+}
+
+func newAccounts() *accounts {
+	return &accounts{}
+}
+
+// accountBackend passes the calls of a store to its backend through the
+// account it belongs to.
+type accountBackend struct {
+	backend Backend
+	account *account
+}
+
+// call makes a call to endpoint once the limits of the account allow it,
+// retrying with exponential backoff while Pinboard answers 429 or a server
+// error.
+func call[T any](ctx context.Context, b *accountBackend, endpoint string, f func() (T, error)) (T, error) {
+	var zero T
+	for retry := 1; ; retry++ {
+		err := b.account.wait(ctx, endpoint)
+		if err != nil {
+			return zero, err
+		}
+
+		v, err := f()
+		if err == nil || ctx.Err() != nil || !retryable(err) || retry > b.account.limits.retries {
+			return v, err
+		}
+
+		d := b.account.limits.delay(retry)
+		b.account.limits.logf("%s failed with %s, retrying in %s (%d/%d)", endpoint, err, d, retry, b.account.limits.retries)
+		b.account.hold(d)
+	}
+}
+
+func (b *accountBackend) Authenticate(ctx context.Context) error {
+	_, err := call(ctx, b, "user/secret", none(func() error {
+		return b.backend.Authenticate(ctx)
+	}))
+	return err
+}
+
+func (b *accountBackend) Add(ctx context.Context, opts *pinboard.PostsAddOptions) error {
+	defer b.account.forget()
+	_, err := call(ctx, b, "posts/add", none(func() error {
+		return b.backend.Add(ctx, opts)
+	}))
+	return err
+}
+
+func (b *accountBackend) Delete(ctx context.Context, url string) error {
+	defer b.account.forget()
+	_, err := call(ctx, b, "posts/delete", none(func() error {
+		return b.backend.Delete(ctx, url)
+	}))
+	return err
+}
+
+func (b *accountBackend) Get(ctx context.Context, opts *pinboard.PostsGetOptions) ([]*pinboard.Post, error) {
+	return call(ctx, b, "posts/get", func() ([]*pinboard.Post, error) {
+		return b.backend.Get(ctx, opts)
+	})
+}
+
+func (b *accountBackend) All(ctx context.Context, opts *pinboard.PostsAllOptions) ([]*pinboard.Post, error) {
+	return call(ctx, b, "posts/all", func() ([]*pinboard.Post, error) {
+		return b.backend.All(ctx, opts)
+	})
+}
+
+func (b *accountBackend) Recent(ctx context.Context, opts *pinboard.PostsRecentOptions) ([]*pinboard.Post, error) {
+	return call(ctx, b, "posts/recent", func() ([]*pinboard.Post, error) {
+		return b.backend.Recent(ctx, opts)
+	})
+}
+
+func (b *accountBackend) Dates(ctx context.Context, opts *pinboard.PostsDatesOptions) (map[string]int, error) {
+	return call(ctx, b, "posts/dates", func() (map[string]int, error) {
+		return b.backend.Dates(ctx, opts)
+	})
+}
+
+func (b *accountBackend) Update(ctx context.Context) (time.Time, error) {
+	return b.account.lastUpdate(func() (time.Time, error) {
+		return call(ctx, b, "posts/update", func() (time.Time, error) {
+			return b.backend.Update(ctx)
+		})
+	})
+}
+
+func (b *accountBackend) Tags(ctx context.Context) (map[string]int, error) {
+	return call(ctx, b, "tags/get", func() (map[string]int, error) {
+		return b.backend.Tags(ctx)
+	})
+}
+
+func (b *accountBackend) DeleteTag(ctx context.Context, tag string) error {
+	defer b.account.forget()
+	_, err := call(ctx, b, "tags/delete", none(func() error {
+		return b.backend.DeleteTag(ctx, tag)
+	}))
+	return err
+}
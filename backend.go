@@ -0,0 +1,156 @@
+package pindb
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/tmstn/pinboard"
+)
+
+// ErrNotFound is returned by Backend.Delete when there is no post at the url.
+var ErrNotFound = errors.New("item not found")
+
+// Backend is the bookmark service a store is synchronised with. Every call
+// takes the context of the operation that makes it and should return
+// ctx.Err() once it is done. Stores of one account may call it at the same
+// time, so a backend must be safe for concurrent use.
+type Backend interface {
+	Authenticate(ctx context.Context) error
+	Add(ctx context.Context, opts *pinboard.PostsAddOptions) error
+	Delete(ctx context.Context, url string) error
+	Get(ctx context.Context, opts *pinboard.PostsGetOptions) ([]*pinboard.Post, error)
+	All(ctx context.Context, opts *pinboard.PostsAllOptions) ([]*pinboard.Post, error)
+	Recent(ctx context.Context, opts *pinboard.PostsRecentOptions) ([]*pinboard.Post, error)
+	Dates(ctx context.Context, opts *pinboard.PostsDatesOptions) (map[string]int, error)
+	Update(ctx context.Context) (time.Time, error)
+	Tags(ctx context.Context) (map[string]int, error)
+	DeleteTag(ctx context.Context, tag string) error
+}
+
+type BackendFactory func(token string) Backend
+
+type pinboardBackend struct {
+	pb *pinboard.Client
+}
+
+// abandon runs f until ctx is done. The pinboard client cannot cancel a
+// request, so when ctx is done first abandon returns at once and the
+// request finishes in the background.
+func abandon[T any](ctx context.Context, f func() (T, error)) (T, error) {
+	var zero T
+	if err := ctx.Err(); err != nil {
+		return zero, err
+	}
+
+	if ctx.Done() == nil {
+		return f()
+	}
+
+	type result struct {
+		v   T
+		err error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		v, err := f()
+		done <- result{v, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.v, r.err
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+}
+
+// none adapts a call without a result for abandon.
+func none(f func() error) func() (struct{}, error) {
+	return func() (struct{}, error) {
+		return struct{}{}, f()
+	}
+}
+
+func (p *pinboardBackend) Authenticate(ctx context.Context) error {
+	_, err := abandon(ctx, func() (string, error) {
+		return p.pb.User.Secret()
+	})
+	return err
+}
+
+func (p *pinboardBackend) Add(ctx context.Context, opts *pinboard.PostsAddOptions) error {
+	_, err := abandon(ctx, none(func() error {
+		return p.pb.Posts.Add(opts)
+	}))
+	return err
+}
+
+func (p *pinboardBackend) Delete(ctx context.Context, url string) error {
+	_, err := abandon(ctx, none(func() error {
+		return p.pb.Posts.Delete(url)
+	}))
+
+	// pinboard reports the result code as the message
+	if err != nil && err.Error() == ErrNotFound.Error() {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (p *pinboardBackend) Get(ctx context.Context, opts *pinboard.PostsGetOptions) ([]*pinboard.Post, error) {
+	return abandon(ctx, func() ([]*pinboard.Post, error) {
+		return p.pb.Posts.Get(opts)
+	})
+}
+
+func (p *pinboardBackend) All(ctx context.Context, opts *pinboard.PostsAllOptions) ([]*pinboard.Post, error) {
+	return abandon(ctx, func() ([]*pinboard.Post, error) {
+		return p.pb.Posts.All(opts)
+	})
+}
+
+func (p *pinboardBackend) Recent(ctx context.Context, opts *pinboard.PostsRecentOptions) ([]*pinboard.Post, error) {
+	return abandon(ctx, func() ([]*pinboard.Post, error) {
+		return p.pb.Posts.Recent(opts)
+	})
+}
+
+func (p *pinboardBackend) Dates(ctx context.Context, opts *pinboard.PostsDatesOptions) (map[string]int, error) {
+	return abandon(ctx, func() (map[string]int, error) {
+		return p.pb.Posts.Dates(opts)
+	})
+}
+
+func (p *pinboardBackend) Update(ctx context.Context) (time.Time, error) {
+	return abandon(ctx, p.pb.Posts.Update)
+}
+
+func (p *pinboardBackend) Tags(ctx context.Context) (map[string]int, error) {
+	tags, err := abandon(ctx, p.pb.Tags.Get)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := map[string]int{}
+	for t, c := range tags {
+		n, _ := strconv.Atoi(c)
+		counts[t] = n
+	}
+	return counts, nil
+}
+
+func (p *pinboardBackend) DeleteTag(ctx context.Context, tag string) error {
+	_, err := abandon(ctx, none(func() error {
+		return p.pb.Tags.Delete(tag)
+	}))
+	return err
+}
+
+func NewPinboardBackend(token string) Backend {
+	return &pinboardBackend{
+		pb: pinboard.New(token),
+	}
+}
@@ -1,16 +1,15 @@
 package pindb
 
 import (
-	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net/url"
-	"regexp"
-	"strings"
+	"sort"
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/tmstn/pinboard"
 )
 
 type buckets map[uuid.UUID]*Bucket
@@ -41,26 +40,36 @@ func (b *buckets) unset(bucket *Bucket) error {
 	return nil
 }
 
-func (b *buckets) writeBytes() []byte {
-	var f bytes.Buffer
-	for _, v := range *b {
-		fmt.Fprintf(&f, "%s\n", v.record())
+func (b *buckets) writeTo(w io.Writer) error {
+	for _, v := range b.list() {
+		err := v.writeTo(w)
+		if err != nil {
+			return err
+		}
 	}
-	return f.Bytes()
+	return nil
 }
 
+// list returns the buckets ordered by name, then uuid.
 func (b *buckets) list() []*Bucket {
 	buckets := []*Bucket{}
 	for _, v := range *b {
 		buckets = append(buckets, v)
 	}
+
+	sort.Slice(buckets, func(i, j int) bool {
+		if buckets[i].name != buckets[j].name {
+			return buckets[i].name < buckets[j].name
+		}
+		return buckets[i].uuid.String() < buckets[j].uuid.String()
+	})
 	return buckets
 }
 
 func (b *buckets) json() BucketsJSON {
 	j := BucketsJSON{}
 	for _, v := range b.list() {
-		j = append(j, v.JSON())
+		j = append(j, v.json())
 	}
 	return j
 }
@@ -74,14 +83,70 @@ type Bucket struct {
 	uuid        uuid.UUID
 	name        string
 	links       *links
+	groups      *groups
 	store       *Store
 }
 
 func (b *Bucket) Links() []*Link {
+	b.store.mu.RLock()
+	defer b.store.mu.RUnlock()
 	return b.links.list()
 }
 
+func (b *Bucket) Groups() []*Group {
+	b.store.mu.RLock()
+	defer b.store.mu.RUnlock()
+	return b.groups.list()
+}
+
+func (b *Bucket) Group(uuid uuid.UUID) (*Group, error) {
+	b.store.mu.RLock()
+	defer b.store.mu.RUnlock()
+	return b.groups.get(uuid)
+}
+
+// FindGroup looks a group up by its uuid or, failing that, its name.
+func (b *Bucket) FindGroup(key string) (*Group, error) {
+	b.store.mu.RLock()
+	defer b.store.mu.RUnlock()
+
+	uid, err := uuid.Parse(key)
+	if err == nil && b.groups.has(uid) {
+		return b.groups.get(uid)
+	}
+
+	for _, g := range b.groups.list() {
+		if g.name == key {
+			return g, nil
+		}
+	}
+
+	return nil, errors.New("group does not exist")
+}
+
+func (b *Bucket) AddGroup(name string) (*Group, error) {
+	b.store.mu.Lock()
+	defer b.store.mu.Unlock()
+
+	g, err := newGroup(b, name)
+	if err != nil {
+		return nil, err
+	}
+
+	b.groups.set(g)
+	return g, nil
+}
+
+// Tags counts the user tags on the links of the bucket.
+func (b *Bucket) Tags() map[Tag]int {
+	b.store.mu.RLock()
+	defer b.store.mu.RUnlock()
+	return countTags(b.links.list())
+}
+
 func (b *Bucket) RefreshedAt() *time.Time {
+	b.store.mu.RLock()
+	defer b.store.mu.RUnlock()
 	return b.refreshedAt
 }
 
@@ -90,6 +155,8 @@ func (b *Bucket) UUID() uuid.UUID {
 }
 
 func (b *Bucket) Name() string {
+	b.store.mu.RLock()
+	defer b.store.mu.RUnlock()
 	return b.name
 }
 
@@ -98,147 +165,201 @@ func (b *Bucket) Tag() Tag {
 }
 
 func (b *Bucket) Link(key uuid.UUID) (*Link, error) {
+	b.store.mu.RLock()
+	defer b.store.mu.RUnlock()
 	return b.links.get(key)
 }
 
 func (b *Bucket) Has(key uuid.UUID) bool {
+	b.store.mu.RLock()
+	defer b.store.mu.RUnlock()
 	return b.links.has(key)
 }
 
-func (b *Bucket) Add(title string, url *url.URL, group Tag, tags ...Tag) (*Link, error) {
-	l, err := newLink(b, title, url, group, tags...)
-	if err != nil {
-		return nil, err
-	}
+func (b *Bucket) Add(title string, url *url.URL, group *Group, tags ...Tag) (*Link, error) {
+	return b.AddContext(context.Background(), title, url, group, tags...)
+}
 
-	q := l.url.Query()
-	q.Set("pindbuuid", l.uuid.String())
-	l.url.RawQuery = q.Encode()
+func (b *Bucket) AddContext(ctx context.Context, title string, url *url.URL, group *Group, tags ...Tag) (*Link, error) {
+	var l *Link
+	err := b.store.change(ctx, func() error {
+		gt := NewTag("")
+		if group != nil {
+			if group.bucket != b {
+				return errors.New("group belongs to another bucket")
+			}
+			gt = group.Tag()
+		}
 
-	err = b.store.user.pb.Posts.Add(l.Options(false))
-	if err != nil {
-		return nil, err
-	}
+		n, err := newLink(b, title, url, gt, tags...)
+		if err != nil {
+			return err
+		}
 
-	l.description = l.record()
-	l.Validate()
-	b.links.set(l)
+		q := n.url.Query()
+		q.Set("pindbuuid", n.uuid.String())
+		n.url.RawQuery = q.Encode()
 
-	return l, nil
+		n.options(false)
+		n.validate()
+		b.links.set(n)
+		b.store.enqueue(newOperation(AddOperation, n))
+
+		l = n
+		return nil
+	})
+	return l, err
 }
 
 func (b *Bucket) Rename(name string) *Bucket {
+	b.store.mu.Lock()
+	defer b.store.mu.Unlock()
+
 	b.name = name
 	return b
 }
 
 func (b *Bucket) Remove(removeLinks, removeTags bool) (*Bucket, error) {
+	return b.RemoveContext(context.Background(), removeLinks, removeTags)
+}
+
+func (b *Bucket) RemoveContext(ctx context.Context, removeLinks, removeTags bool) (*Bucket, error) {
+	b.store.remote.Lock()
+	defer b.store.remote.Unlock()
+
+	err := b.remove(ctx, removeLinks, removeTags)
+	if err != nil {
+		return b, err
+	}
+	return nil, nil
+}
+
+// remove is called with remote held and mu not.
+func (b *Bucket) remove(ctx context.Context, removeLinks, removeTags bool) error {
+	s := b.store
+	s.mu.Lock()
+	if s.tx != nil && removeTags {
+		s.mu.Unlock()
+		return ErrTransaction
+	}
+
+	// in a transaction the links are deleted when it is committed
+	if s.tx != nil && removeLinks {
+		for _, l := range b.links.list() {
+			s.enqueue(newOperation(DeleteOperation, l))
+		}
+		removeLinks = false
+	}
+
+	urls := []string{}
+	for _, l := range *b.links {
+		urls = append(urls, l.url.String())
+	}
+	s.mu.Unlock()
+
 	if removeLinks || removeTags {
-		for _, l := range *b.links {
-			var err error
+		api, err := s.api(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, u := range urls {
 			if removeLinks {
-				err = b.store.pb.Posts.Delete(l.url.String())
+				err = api.Delete(ctx, u)
 			} else if removeTags {
-				tag := fmt.Sprintf("/pindb/store:\"%s\"/bucket:\"%s\"", b.store.uuid.String(), b.uuid.String())
-				err = b.store.pb.Tags.Delete(tag)
+				tag := fmt.Sprintf("/pindb/store:\"%s\"/bucket:\"%s\"", s.uuid.String(), b.uuid.String())
+				err = api.DeleteTag(ctx, tag)
 			}
 			if err != nil {
-				return b, err
+				return err
 			}
 		}
 	}
-	b.store.buckets.unset(b)
-	return nil, nil
-}
 
-func (b *Bucket) Refresh(force bool) (*Bucket, error) {
-	if !force {
-		refreshed, err := b.Updated()
-		if err != nil {
-			return b, err
-		}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buckets.unset(b)
+	return nil
+}
 
-		if !refreshed {
-			return b, err
-		}
-	}
+func (b *Bucket) Refresh(force bool) (*RefreshResult, error) {
+	return b.RefreshContext(context.Background(), force)
+}
 
-	posts, err := b.store.pb.Posts.All(&pinboard.PostsAllOptions{
-		Tag: []string{
-			fmt.Sprintf(
-				"/pindb/store:\"%s\"/bucket:\"%s\"",
-				b.store.uuid.String(),
-				b.uuid.String())},
-	})
+func (b *Bucket) RefreshContext(ctx context.Context, force bool) (*RefreshResult, error) {
+	b.store.remote.Lock()
+	defer b.store.remote.Unlock()
+	return b.refresh(ctx, force, false)
+}
 
-	if err != nil {
-		return b, err
-	}
+func (b *Bucket) Preview(force bool) (*RefreshResult, error) {
+	return b.PreviewContext(context.Background(), force)
+}
 
-	links := newLinks()
-	for _, post := range posts {
-		link, err := newLink(
-			b,
-			post.Description,
-			post.Href,
-			NewTag(""),
-			newTags().populate(post.Tags...)...,
-		)
+func (b *Bucket) PreviewContext(ctx context.Context, force bool) (*RefreshResult, error) {
+	b.store.remote.Lock()
+	defer b.store.remote.Unlock()
+	return b.refresh(ctx, force, true)
+}
 
-		if err != nil {
-			return b, err
+// keepPending carries links with queued changes over into a freshly
+// fetched set of links so a refresh does not discard unpushed work.
+func (b *Bucket) keepPending(links *links) {
+	for _, op := range b.store.queue.list() {
+		if op.bucket != b.uuid {
+			continue
 		}
 
-		uid := link.url.Query().Get("pindbuuid")
-		if strings.TrimSpace(uid) == "" {
-			q := link.url.Query()
-			q.Set("pindbuuid", link.uuid.String())
-			link.url.RawQuery = q.Encode()
-		} else {
-			puid, err := uuid.Parse(uid)
-			if err == nil {
-				link.uuid = puid
-			}
+		if op.kind == DeleteOperation {
+			delete(*links, op.link)
+			continue
 		}
 
-		rg := regexp.MustCompile(fmt.Sprintf(`^/pindb/bucket:\"%s\"/group:\"([0-9a-f\-]+)\"$`, link.bucket.uuid.String()))
-		for _, t := range link.tags {
-			if rg.MatchString(t.String()) {
-				link.group = NewTag(rg.FindStringSubmatch(t.String())[1])
-			}
+		l, err := b.links.get(op.link)
+		if err == nil {
+			links.set(l)
 		}
-
-		link.description = link.record()
-		link.Validate()
-		links.set(link)
 	}
-
-	b.links = links
-	ut := time.Now()
-	b.refreshedAt = &ut
-	return b, nil
 }
 
 func (b *Bucket) Updated() (bool, error) {
-	if b.refreshedAt == nil {
+	return b.UpdatedContext(context.Background())
+}
+
+func (b *Bucket) UpdatedContext(ctx context.Context) (bool, error) {
+	b.store.remote.Lock()
+	defer b.store.remote.Unlock()
+
+	b.store.mu.RLock()
+	since := b.refreshedAt
+	b.store.mu.RUnlock()
+
+	if since == nil {
 		return true, nil
 	}
 
-	t, err := b.store.pb.Posts.Update()
+	api, err := b.store.api(ctx)
 	if err != nil {
 		return false, err
 	}
 
-	return t.After(*b.refreshedAt), nil
+	return changed(ctx, api, since)
 }
 
 func (b *Bucket) JSON() BucketJSON {
+	b.store.mu.RLock()
+	defer b.store.mu.RUnlock()
+	return b.json()
+}
+
+func (b *Bucket) json() BucketJSON {
 	j := BucketJSON{}
 	j.Name = b.name
 	j.UUID = b.uuid.String()
 	if b.refreshedAt != nil {
 		j.RefreshedAt = b.refreshedAt.Format(time.RFC3339)
 	}
+	j.Groups = b.groups.json()
 	j.Links = b.links.json()
 	return j
 }
@@ -249,31 +370,43 @@ func (b *Bucket) record() []byte {
 		t = b.refreshedAt.Format(time.RFC3339)
 	}
 	return []byte(fmt.Sprintf(
-		"B\u2063%s\u2063%s\u2063%s\n%s",
+		"B\u2063%s\u2063%s\u2063%s",
 		b.uuid.String(),
 		t,
-		b.name,
-		b.links.writeBytes()))
+		escape(b.name)))
 }
 
-func newBucket(store *Store, name string) (*Bucket, error) {
-	if strings.Contains(name, "\u2063") {
-		return nil, errors.New("name cannot contain invisible separator (U+2063)")
+// writeTo writes the bucket record followed by its groups and links.
+func (b *Bucket) writeTo(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "%s\n", b.record())
+	if err != nil {
+		return err
 	}
 
+	_, err = w.Write(b.groups.writeBytes())
+	if err != nil {
+		return err
+	}
+
+	return b.links.writeTo(w)
+}
+
+func newBucket(store *Store, name string) (*Bucket, error) {
 	return &Bucket{
-		uuid:  uuid.New(),
-		name:  name,
-		links: newLinks(),
-		store: store,
+		uuid:   uuid.New(),
+		name:   name,
+		links:  newLinks(),
+		groups: newGroups(),
+		store:  store,
 	}, nil
 }
 
 type BucketsJSON []BucketJSON
 
 type BucketJSON struct {
-	RefreshedAt string    `json:"refreshed_at,omitempty"`
-	UUID        string    `json:"uuid,omitempty"`
-	Name        string    `json:"name,omitempty"`
-	Links       LinksJSON `json:"links,omitempty"`
+	RefreshedAt string     `json:"refreshed_at,omitempty"`
+	UUID        string     `json:"uuid,omitempty"`
+	Name        string     `json:"name,omitempty"`
+	Groups      GroupsJSON `json:"groups,omitempty"`
+	Links       LinksJSON  `json:"links,omitempty"`
 }
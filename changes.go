@@ -0,0 +1,386 @@
+package pindb
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+type RefreshResult struct {
+	store   uuid.UUID
+	buckets []*BucketChanges
+}
+
+func (r *RefreshResult) Store() uuid.UUID {
+	return r.store
+}
+
+func (r *RefreshResult) Buckets() []*BucketChanges {
+	return r.buckets
+}
+
+func (r *RefreshResult) Empty() bool {
+	return len(r.buckets) == 0
+}
+
+func (r *RefreshResult) add(c *BucketChanges) {
+	if c.Empty() {
+		return
+	}
+
+	r.buckets = append(r.buckets, c)
+	sort.SliceStable(r.buckets, func(i, j int) bool {
+		return r.buckets[i].name < r.buckets[j].name
+	})
+}
+
+func (r *RefreshResult) JSON() RefreshResultJSON {
+	j := RefreshResultJSON{}
+	j.Store = r.store.String()
+	j.Buckets = []BucketChangesJSON{}
+	for _, b := range r.buckets {
+		j.Buckets = append(j.Buckets, b.JSON())
+	}
+	return j
+}
+
+func newRefreshResult(store *Store) *RefreshResult {
+	return &RefreshResult{
+		store:   store.uuid,
+		buckets: []*BucketChanges{},
+	}
+}
+
+// StoreDiff compares two stores, usually two versions of the same store
+// file, bucket by bucket.
+type StoreDiff struct {
+	before  *Store
+	after   *Store
+	added   []*Bucket
+	removed []*Bucket
+	buckets []*BucketChanges
+}
+
+func (d *StoreDiff) Before() *Store {
+	return d.before
+}
+
+func (d *StoreDiff) After() *Store {
+	return d.after
+}
+
+func (d *StoreDiff) Added() []*Bucket {
+	return d.added
+}
+
+func (d *StoreDiff) Removed() []*Bucket {
+	return d.removed
+}
+
+// Buckets lists the changes to buckets found in both stores.
+func (d *StoreDiff) Buckets() []*BucketChanges {
+	return d.buckets
+}
+
+func (d *StoreDiff) Empty() bool {
+	return d.before.Name() == d.after.Name() &&
+		len(d.added) == 0 &&
+		len(d.removed) == 0 &&
+		len(d.buckets) == 0
+}
+
+func (d *StoreDiff) JSON() StoreDiffJSON {
+	j := StoreDiffJSON{}
+	j.Before = d.before.uuid.String()
+	j.After = d.after.uuid.String()
+	if before, after := d.before.Name(), d.after.Name(); before != after {
+		j.Name = &NameChangeJSON{
+			Before: before,
+			After:  after,
+		}
+	}
+	j.Added = BucketsJSON{}
+	for _, b := range d.added {
+		j.Added = append(j.Added, b.JSON())
+	}
+	j.Removed = BucketsJSON{}
+	for _, b := range d.removed {
+		j.Removed = append(j.Removed, b.JSON())
+	}
+	j.Buckets = []BucketChangesJSON{}
+	for _, b := range d.buckets {
+		j.Buckets = append(j.Buckets, b.JSON())
+	}
+	return j
+}
+
+// diffMu serializes Diff, which holds the read locks of two stores at once.
+// Otherwise Diff(a, b) and Diff(b, a) could each hold one lock while a
+// waiting writer keeps the other from being taken. Stores of the same file
+// share a uuid, so there is no order to take the locks in.
+var diffMu sync.Mutex
+
+// Diff compares the buckets and links of two stores.
+func Diff(before, after *Store) *StoreDiff {
+	diffMu.Lock()
+	defer diffMu.Unlock()
+
+	before.mu.RLock()
+	defer before.mu.RUnlock()
+	if after != before {
+		after.mu.RLock()
+		defer after.mu.RUnlock()
+	}
+
+	d := &StoreDiff{
+		before:  before,
+		after:   after,
+		added:   []*Bucket{},
+		removed: []*Bucket{},
+		buckets: []*BucketChanges{},
+	}
+
+	for _, a := range after.buckets.list() {
+		b, err := before.buckets.get(a.uuid)
+		if err != nil {
+			d.added = append(d.added, a)
+			continue
+		}
+
+		c := diffLinks(a, b.links, a.links)
+		c.previous = b.name
+		if !c.Empty() {
+			d.buckets = append(d.buckets, c)
+		}
+	}
+
+	for _, b := range before.buckets.list() {
+		if !after.buckets.has(b.uuid) {
+			d.removed = append(d.removed, b)
+		}
+	}
+
+	return d
+}
+
+// BucketChanges lists the links of a bucket that differ between two states.
+type BucketChanges struct {
+	uuid     uuid.UUID
+	name     string
+	previous string
+	added    []*Link
+	removed  []*Link
+	changed  []*LinkChange
+}
+
+func (c *BucketChanges) UUID() uuid.UUID {
+	return c.uuid
+}
+
+func (c *BucketChanges) Name() string {
+	return c.name
+}
+
+// PreviousName is the name of the bucket before it was renamed, empty when
+// it was not.
+func (c *BucketChanges) PreviousName() string {
+	if c.previous == c.name {
+		return ""
+	}
+	return c.previous
+}
+
+func (c *BucketChanges) Added() []*Link {
+	return c.added
+}
+
+func (c *BucketChanges) Removed() []*Link {
+	return c.removed
+}
+
+func (c *BucketChanges) Changed() []*LinkChange {
+	return c.changed
+}
+
+func (c *BucketChanges) Empty() bool {
+	return c.PreviousName() == "" && len(c.added) == 0 && len(c.removed) == 0 && len(c.changed) == 0
+}
+
+func (c *BucketChanges) JSON() BucketChangesJSON {
+	j := BucketChangesJSON{}
+	j.UUID = c.uuid.String()
+	j.Name = c.name
+	j.PreviousName = c.PreviousName()
+	j.Added = LinksJSON{}
+	for _, l := range c.added {
+		j.Added = append(j.Added, l.JSON())
+	}
+	j.Removed = LinksJSON{}
+	for _, l := range c.removed {
+		j.Removed = append(j.Removed, l.JSON())
+	}
+	j.Changed = []LinkChangeJSON{}
+	for _, l := range c.changed {
+		j.Changed = append(j.Changed, l.JSON())
+	}
+	return j
+}
+
+type LinkField string
+
+func (f LinkField) String() string {
+	return string(f)
+}
+
+const (
+	TitleField LinkField = "title"
+	URLField   LinkField = "url"
+	GroupField LinkField = "group"
+	TagsField  LinkField = "tags"
+)
+
+// LinkChange is a link that exists in both states with different fields.
+type LinkChange struct {
+	before *Link
+	after  *Link
+	fields []LinkField
+}
+
+func (c *LinkChange) Before() *Link {
+	return c.before
+}
+
+func (c *LinkChange) After() *Link {
+	return c.after
+}
+
+func (c *LinkChange) Fields() []LinkField {
+	return c.fields
+}
+
+func (c *LinkChange) JSON() LinkChangeJSON {
+	j := LinkChangeJSON{}
+	j.UUID = c.after.uuid.String()
+	j.Fields = []string{}
+	for _, f := range c.fields {
+		j.Fields = append(j.Fields, f.String())
+	}
+	j.Before = c.before.JSON()
+	j.After = c.after.JSON()
+	return j
+}
+
+func compareLinks(before, after *Link) []LinkField {
+	fields := []LinkField{}
+	if before.title != after.title {
+		fields = append(fields, TitleField)
+	}
+	if before.url.String() != after.url.String() {
+		fields = append(fields, URLField)
+	}
+	if before.group.String() != after.group.String() {
+		fields = append(fields, GroupField)
+	}
+
+	bt := append(Tags{}, before.tags...)
+	at := append(Tags{}, after.tags...)
+	sort.Sort(bt)
+	sort.Sort(at)
+	if strings.Join(bt.Strings(), " ") != strings.Join(at.Strings(), " ") {
+		fields = append(fields, TagsField)
+	}
+	return fields
+}
+
+func diffLinks(bucket *Bucket, before, after *links) *BucketChanges {
+	c := &BucketChanges{
+		uuid:     bucket.uuid,
+		name:     bucket.name,
+		previous: bucket.name,
+		added:    []*Link{},
+		removed:  []*Link{},
+		changed:  []*LinkChange{},
+	}
+
+	for id, a := range *after {
+		b, ok := (*before)[id]
+		if !ok {
+			c.added = append(c.added, a)
+			continue
+		}
+
+		fields := compareLinks(b, a)
+		if len(fields) > 0 {
+			// the link is updated in place when the changes are applied
+			before := *b
+			c.changed = append(c.changed, &LinkChange{
+				before: &before,
+				after:  a,
+				fields: fields,
+			})
+		}
+	}
+
+	for id, b := range *before {
+		if _, ok := (*after)[id]; !ok {
+			c.removed = append(c.removed, b)
+		}
+	}
+
+	sortLinks(c.added)
+	sortLinks(c.removed)
+	sort.Slice(c.changed, func(i, j int) bool {
+		return lessLink(c.changed[i].after, c.changed[j].after)
+	})
+	return c
+}
+
+func sortLinks(l []*Link) {
+	sort.Slice(l, func(i, j int) bool {
+		return lessLink(l[i], l[j])
+	})
+}
+
+func lessLink(a, b *Link) bool {
+	if a.title != b.title {
+		return a.title < b.title
+	}
+	return a.uuid.String() < b.uuid.String()
+}
+
+type RefreshResultJSON struct {
+	Store   string              `json:"store,omitempty"`
+	Buckets []BucketChangesJSON `json:"buckets"`
+}
+
+type StoreDiffJSON struct {
+	Before  string              `json:"before,omitempty"`
+	After   string              `json:"after,omitempty"`
+	Name    *NameChangeJSON     `json:"name,omitempty"`
+	Added   BucketsJSON         `json:"added"`
+	Removed BucketsJSON         `json:"removed"`
+	Buckets []BucketChangesJSON `json:"buckets"`
+}
+
+type NameChangeJSON struct {
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+type BucketChangesJSON struct {
+	UUID         string           `json:"uuid,omitempty"`
+	Name         string           `json:"name,omitempty"`
+	PreviousName string           `json:"previous_name,omitempty"`
+	Added        LinksJSON        `json:"added"`
+	Removed      LinksJSON        `json:"removed"`
+	Changed      []LinkChangeJSON `json:"changed"`
+}
+
+type LinkChangeJSON struct {
+	UUID   string   `json:"uuid,omitempty"`
+	Fields []string `json:"fields"`
+	Before LinkJSON `json:"before"`
+	After  LinkJSON `json:"after"`
+}
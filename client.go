@@ -1,65 +1,277 @@
 package pindb
 
 import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"sync"
+	"time"
+
 	"github.com/google/uuid"
 )
 
+var ErrOffline = errors.New("pinboard is not available in offline mode")
+
+type Option func(*Client)
+
+// WithOffline refuses every call to Pinboard. Stores can still be read,
+// inspected and written locally.
+func WithOffline() Option {
+	return func(c *Client) {
+		c.offline = true
+	}
+}
+
+// WithBackend synchronises every store with backend instead of Pinboard.
+// Calls to it are not spaced unless WithRateLimit, WithRecentRateLimit or
+// WithAllRateLimit say otherwise.
+func WithBackend(backend Backend) Option {
+	return func(c *Client) {
+		c.backend = func(string) Backend {
+			return backend
+		}
+	}
+}
+
+// WithBackendFactory creates the backend for each store from its token.
+// Calls to it are spaced as with WithBackend.
+func WithBackendFactory(factory BackendFactory) Option {
+	return func(c *Client) {
+		c.backend = factory
+	}
+}
+
+// WithHistory keeps the last n versions of a store file as snapshots each
+// time it is written.
+func WithHistory(n int) Option {
+	return func(c *Client) {
+		c.history = n
+	}
+}
+
+// WithRateLimit spaces the calls to the backend for one account at least
+// interval apart, however many stores use it. It is DefaultRateLimit unless
+// set, 0 lifts it.
+func WithRateLimit(interval time.Duration) Option {
+	return func(c *Client) {
+		c.pacing.interval = &interval
+	}
+}
+
+// WithRecentRateLimit spaces the calls to posts/recent for one account at
+// least interval apart. It is DefaultRecentRateLimit unless set.
+func WithRecentRateLimit(interval time.Duration) Option {
+	return func(c *Client) {
+		c.pacing.recent = &interval
+	}
+}
+
+// WithAllRateLimit spaces the calls to posts/all for one account at least
+// interval apart. It is DefaultAllRateLimit unless set.
+func WithAllRateLimit(interval time.Duration) Option {
+	return func(c *Client) {
+		c.pacing.all = &interval
+	}
+}
+
+// WithRetries retries a call that failed with 429 or a server error up to
+// retries times, waiting backoff before the first retry and doubling the
+// wait after each.
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.limits.retries = retries
+		c.limits.backoff = backoff
+	}
+}
+
+// WithLogger reports waits for the rate limit and retries to logger.
+func WithLogger(logger *log.Logger) Option {
+	return func(c *Client) {
+		c.limits.logger = logger
+	}
+}
+
+// Client is safe for concurrent use.
 type Client struct {
-	stores *stores
+	mu      sync.RWMutex
+	stores  *stores
+	offline bool
+	history int
+	limits  limits
+	pacing  pacing
+	backend BackendFactory
+
+	// amu guards accounts and is never held while taking another lock
+	amu      sync.Mutex
+	accounts *accounts
 }
 
 func (c *Client) Stores() []*Store {
-	return c.stores.list()
+	c.mu.RLock()
+	stores := c.stores.copy()
+	c.mu.RUnlock()
+	return stores.list()
 }
 
 func (c *Client) Store(uuid uuid.UUID) (*Store, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	return c.stores.get(uuid)
 }
 
 func (c *Client) Has(uuid uuid.UUID) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	return c.stores.has(uuid)
 }
 
+// add holds s in the client. A client only ever takes the lock of a store
+// while holding its own, never the other way round.
+func (c *Client) add(s *Store) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s.client = c
+	c.stores.set(s)
+}
+
+func (c *Client) remove(s *Store) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stores.unset(s)
+}
+
+func (c *Client) Offline() bool {
+	return c.offline
+}
+
+func (c *Client) keep() int {
+	if c == nil {
+		return 0
+	}
+	return c.history
+}
+
+func (c *Client) account(token string) *account {
+	if c == nil {
+		return &account{limits: newLimits()}
+	}
+
+	c.amu.Lock()
+	defer c.amu.Unlock()
+	return c.accounts.get(token, c.limits)
+}
+
+func (c *Client) newBackend(token string) Backend {
+	if c == nil || c.backend == nil {
+		return NewPinboardBackend(token)
+	}
+	return c.backend(token)
+}
+
 func (c *Client) Add(token, name string) (*Store, error) {
-	s, err := newStore(c, token, name)
+	return c.AddContext(context.Background(), token, name)
+}
+
+// AddContext is Add with the authentication of the token bounded by ctx.
+func (c *Client) AddContext(ctx context.Context, token, name string) (*Store, error) {
+	s, err := newStore(ctx, c, token, name)
 	if err != nil {
 		return nil, err
 	}
 
-	c.stores.set(s)
+	c.add(s)
 	return s, nil
 }
 
 func (c *Client) Read(path string) (*Store, error) {
 	s, err := c.stores.read(path)
-	s.client = c
-	return s, err
+	if err != nil {
+		return nil, err
+	}
+	c.add(s)
+	return s, nil
 }
 
 func (c *Client) ReadEncrypted(path string, passphrase string) (*Store, error) {
 	s, err := c.stores.readEncrypted(path, passphrase)
-	s.client = c
-	return s, err
+	if err != nil {
+		return nil, err
+	}
+	c.add(s)
+	return s, nil
+}
+
+// ReadStream parses a store from r as it is read.
+func (c *Client) ReadStream(r io.Reader) (*Store, error) {
+	s, err := c.stores.readFrom(r)
+	if err != nil {
+		return nil, err
+	}
+	c.add(s)
+	return s, nil
+}
+
+func (c *Client) ReadEncryptedStream(r io.Reader, passphrase string) (*Store, error) {
+	s, err := c.stores.readEncryptedFrom(r, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	c.add(s)
+	return s, nil
+}
+
+// ReadJSON rebuilds a store from the JSON written by Store.JSON.
+func (c *Client) ReadJSON(r io.Reader) (*Store, error) {
+	s, err := c.stores.readJSON(r)
+	if err != nil {
+		return nil, err
+	}
+	c.add(s)
+	return s, nil
 }
 
 func (c *Client) ReadBytes(data []byte) (*Store, error) {
 	s, err := c.stores.readBytes(data)
-	s.client = c
-	return s, err
+	if err != nil {
+		return nil, err
+	}
+	c.add(s)
+	return s, nil
 }
 
 func (c *Client) ReadBase64(data string) (*Store, error) {
 	s, err := c.stores.readBase64(data)
-	s.client = c
-	return s, err
+	if err != nil {
+		return nil, err
+	}
+	c.add(s)
+	return s, nil
 }
 
 func (c *Client) JSON() StoresJSON {
-	return c.stores.json()
+	c.mu.RLock()
+	stores := c.stores.copy()
+	c.mu.RUnlock()
+	return stores.json()
 }
 
-func New() *Client {
-	return &Client{
-		stores: newStores(),
+func New(opts ...Option) *Client {
+	c := &Client{
+		stores:   newStores(),
+		limits:   newLimits(),
+		accounts: newAccounts(),
 	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	c.pacing.apply(&c.limits, c.backend == nil)
+	return c
 }
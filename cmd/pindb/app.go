@@ -1,6 +1,9 @@
 package main
 
-import "github.com/urfave/cli/v2"
+import (
+	"github.com/tmstn/pindb"
+	"github.com/urfave/cli/v2"
+)
 
 func createApp() *cli.App {
 	app := &cli.App{
@@ -9,7 +12,7 @@ func createApp() *cli.App {
 		Flags: []cli.Flag{
 			&cli.StringFlag{
 				Name:    "path",
-				Usage:   "a path to a store db file",
+				Usage:   "a path to a store db file, - to read from stdin and write to stdout",
 				Aliases: []string{"p", "pt"},
 			},
 			&cli.StringFlag{
@@ -17,7 +20,60 @@ func createApp() *cli.App {
 				Usage:   "a passphrase to encrypt/decrypt with",
 				Aliases: []string{"pp", "pass"},
 			},
+			&cli.BoolFlag{
+				Name:    "offline",
+				Usage:   "never contact pinboard, failing any operation that needs it",
+				Aliases: []string{"o", "off"},
+			},
+			&cli.IntFlag{
+				Name:    "history",
+				Usage:   "how many previous versions of the store file to keep, 0 to keep none",
+				Aliases: []string{"hist"},
+				Value:   10,
+			},
+			&cli.DurationFlag{
+				Name:    "rate-limit",
+				Usage:   "the least time between calls to pinboard for one account, 0 for no limit",
+				Aliases: []string{"rl"},
+				Value:   pindb.DefaultRateLimit,
+			},
+			&cli.DurationFlag{
+				Name:    "recent-rate-limit",
+				Usage:   "the least time between fetching the recent posts of one account, 0 for no limit",
+				Aliases: []string{"rrl"},
+				Value:   pindb.DefaultRecentRateLimit,
+			},
+			&cli.DurationFlag{
+				Name:    "all-rate-limit",
+				Usage:   "the least time between fetching every post of one account, 0 for no limit",
+				Aliases: []string{"arl"},
+				Value:   pindb.DefaultAllRateLimit,
+			},
+			&cli.IntFlag{
+				Name:    "retries",
+				Usage:   "how many times to retry a call pinboard answered with 429 or a server error",
+				Aliases: []string{"rt"},
+				Value:   pindb.DefaultRetries,
+			},
+			&cli.DurationFlag{
+				Name:    "backoff",
+				Usage:   "how long to wait before the first retry, doubled for each one after it",
+				Aliases: []string{"bo"},
+				Value:   pindb.DefaultBackoff,
+			},
+			&cli.BoolFlag{
+				Name:    "verbose",
+				Usage:   "report waits for the rate limit and retries on stderr",
+				Aliases: []string{"vb"},
+			},
+			&cli.DurationFlag{
+				Name:    "lock-timeout",
+				Usage:   "how long to wait for another pindb process to release the store file",
+				Aliases: []string{"lt"},
+			},
 		},
+		// exit codes are handled in main
+		ExitErrHandler: func(cCtx *cli.Context, err error) {},
 		Commands: []*cli.Command{
 			{
 				Name:    "stores",
@@ -44,7 +100,7 @@ func createApp() *cli.App {
 					{
 						Name:   "add",
 						Usage:  "add a store",
-						Action: addStore,
+						Action: locked(addStore),
 						Flags: []cli.Flag{
 							&cli.StringFlag{
 								Name:     "token",
@@ -68,7 +124,7 @@ func createApp() *cli.App {
 					{
 						Name:   "rename",
 						Usage:  "rename a store",
-						Action: renameStore,
+						Action: locked(renameStore),
 						Flags: []cli.Flag{
 							&cli.StringFlag{
 								Name:     "name",
@@ -86,7 +142,7 @@ func createApp() *cli.App {
 					{
 						Name:   "remove",
 						Usage:  "remove a store",
-						Action: removeStore,
+						Action: locked(removeStore),
 						Flags: []cli.Flag{
 							&cli.BoolFlag{
 								Name:    "remove-links",
@@ -103,13 +159,156 @@ func createApp() *cli.App {
 					{
 						Name:   "refresh",
 						Usage:  "refresh store from pinboard",
-						Action: refreshStore,
+						Action: locked(refreshStore),
 						Flags: []cli.Flag{
 							&cli.BoolFlag{
 								Name:    "force",
 								Usage:   "force the refresh",
 								Aliases: []string{"f", "frc"},
 							},
+							&cli.BoolFlag{
+								Name:    "report",
+								Usage:   "print the links that were added, removed or changed",
+								Aliases: []string{"r", "rep"},
+							},
+							&cli.BoolFlag{
+								Name:    "dry-run",
+								Usage:   "print the changes without applying them",
+								Aliases: []string{"d", "dry"},
+							},
+							&cli.StringFlag{
+								Name:    "format",
+								Usage:   "the report format, text or json",
+								Aliases: []string{"fmt"},
+								Value:   "text",
+							},
+						},
+					},
+					{
+						Name:   "manifest",
+						Usage:  "publish store and bucket metadata to a private pinboard post",
+						Action: locked(manifestStore),
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:    "enable",
+								Usage:   "publish the manifest and keep it updated on refresh",
+								Aliases: []string{"e", "en"},
+							},
+							&cli.BoolFlag{
+								Name:    "disable",
+								Usage:   "stop publishing the manifest and remove it from pinboard",
+								Aliases: []string{"d", "dis"},
+							},
+						},
+					},
+					{
+						Name:   "recover",
+						Usage:  "rebuild a lost store from pinboard",
+						Action: locked(recoverStore),
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "token",
+								Usage:    "a pinboard api token",
+								Aliases:  []string{"t", "tkn"},
+								Required: true,
+							},
+							&cli.StringFlag{
+								Name:     "store-uuid",
+								Usage:    "the uuid of the store to recover",
+								Aliases:  []string{"u", "uid"},
+								Required: true,
+							},
+							&cli.StringFlag{
+								Name:    "name",
+								Usage:   "the name of the recovered store",
+								Aliases: []string{"n", "nm"},
+							},
+							&cli.StringFlag{
+								Name:    "format",
+								Usage:   "the report format, text or json",
+								Aliases: []string{"fmt"},
+								Value:   "text",
+							},
+						},
+					},
+					{
+						Name:      "diff",
+						Usage:     "compare the buckets and links of two store files",
+						ArgsUsage: "<before> <after>",
+						Action:    diffStores,
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:    "format",
+								Usage:   "the report format, text or json",
+								Aliases: []string{"fmt"},
+								Value:   "text",
+							},
+						},
+					},
+					{
+						Name:      "import",
+						Usage:     "rebuild a store file from its export",
+						ArgsUsage: "[<file>]",
+						Action:    locked(importStore),
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:    "format",
+								Usage:   "the format of the export, json as written by stores json",
+								Aliases: []string{"fmt"},
+								Value:   "json",
+							},
+							&cli.BoolFlag{
+								Name:    "overwrite",
+								Usage:   "replace the store file if it exists",
+								Aliases: []string{"w", "ow"},
+							},
+						},
+					},
+					{
+						Name:   "history",
+						Usage:  "list the previous versions of a store file",
+						Action: historyStore,
+					},
+					{
+						Name:   "rollback",
+						Usage:  "restore a previous version of a store file",
+						Action: locked(rollbackStore),
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "to",
+								Usage:    "the name of the snapshot to restore, as listed by history",
+								Required: true,
+							},
+						},
+					},
+					{
+						Name:   "migrate",
+						Usage:  "rewrite a store file in the current file format",
+						Action: locked(migrateStore),
+					},
+					{
+						Name:   "doctor",
+						Usage:  "check a store and its pinboard posts for problems, exiting non-zero when any are found",
+						Action: doctorStore,
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:    "format",
+								Usage:   "the report format, text or json",
+								Aliases: []string{"fmt"},
+								Value:   "text",
+							},
+						},
+					},
+					{
+						Name:   "rekey",
+						Usage:  "re-encrypt a store, upgrading it to the current encryption format",
+						Action: locked(rekeyStore),
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:    "new-passphrase",
+								Usage:   "the passphrase to encrypt with, defaults to the current passphrase",
+								Aliases: []string{"np", "newpass"},
+							},
 						},
 					},
 					{
@@ -169,7 +368,7 @@ func createApp() *cli.App {
 					{
 						Name:   "add",
 						Usage:  "add a bucket",
-						Action: addBucket,
+						Action: locked(addBucket),
 						Flags: []cli.Flag{
 							&cli.StringFlag{
 								Name:     "name",
@@ -187,7 +386,7 @@ func createApp() *cli.App {
 					{
 						Name:   "rename",
 						Usage:  "rename a bucket",
-						Action: renameBucket,
+						Action: locked(renameBucket),
 						Flags: []cli.Flag{
 							&cli.StringFlag{
 								Name:     "uuid",
@@ -211,7 +410,7 @@ func createApp() *cli.App {
 					{
 						Name:   "remove",
 						Usage:  "remove a bucket",
-						Action: removeBucket,
+						Action: locked(removeBucket),
 						Flags: []cli.Flag{
 							&cli.StringFlag{
 								Name:     "uuid",
@@ -234,7 +433,7 @@ func createApp() *cli.App {
 					{
 						Name:   "refresh",
 						Usage:  "refresh a bucket from pinboard",
-						Action: refreshBucket,
+						Action: locked(refreshBucket),
 						Flags: []cli.Flag{
 							&cli.StringFlag{
 								Name:     "uuid",
@@ -247,6 +446,150 @@ func createApp() *cli.App {
 								Usage:   "force the refresh",
 								Aliases: []string{"f", "frc"},
 							},
+							&cli.BoolFlag{
+								Name:    "report",
+								Usage:   "print the links that were added, removed or changed",
+								Aliases: []string{"r", "rep"},
+							},
+							&cli.BoolFlag{
+								Name:    "dry-run",
+								Usage:   "print the changes without applying them",
+								Aliases: []string{"d", "dry"},
+							},
+							&cli.StringFlag{
+								Name:    "format",
+								Usage:   "the report format, text or json",
+								Aliases: []string{"fmt"},
+								Value:   "text",
+							},
+						},
+					},
+					{
+						Name:    "groups",
+						Aliases: []string{"g", "grp"},
+						Usage:   "manage the groups of a bucket",
+						Subcommands: []*cli.Command{
+							{
+								Name:   "list",
+								Usage:  "list the groups of a bucket",
+								Action: listGroups,
+								Flags: []cli.Flag{
+									&cli.StringFlag{
+										Name:     "bucket",
+										Usage:    "the uuid of the bucket",
+										Aliases:  []string{"b", "bck"},
+										Required: true,
+									},
+								},
+							},
+							{
+								Name:   "add",
+								Usage:  "add a group",
+								Action: locked(addGroup),
+								Flags: []cli.Flag{
+									&cli.StringFlag{
+										Name:     "bucket",
+										Usage:    "the uuid of the bucket",
+										Aliases:  []string{"b", "bck"},
+										Required: true,
+									},
+									&cli.StringFlag{
+										Name:     "name",
+										Usage:    "the name of the group",
+										Aliases:  []string{"n", "nm"},
+										Required: true,
+									},
+									&cli.IntFlag{
+										Name:    "order",
+										Usage:   "the position of the group when listed",
+										Aliases: []string{"o", "ord"},
+									},
+									&cli.BoolFlag{
+										Name:    "print",
+										Usage:   "print result of the operation",
+										Aliases: []string{"p", "pr"},
+									},
+								},
+							},
+							{
+								Name:   "rename",
+								Usage:  "rename a group",
+								Action: locked(renameGroup),
+								Flags: []cli.Flag{
+									&cli.StringFlag{
+										Name:     "bucket",
+										Usage:    "the uuid of the bucket",
+										Aliases:  []string{"b", "bck"},
+										Required: true,
+									},
+									&cli.StringFlag{
+										Name:     "group",
+										Usage:    "the uuid or name of the group",
+										Aliases:  []string{"g", "grp"},
+										Required: true,
+									},
+									&cli.StringFlag{
+										Name:     "name",
+										Usage:    "the name of the group",
+										Aliases:  []string{"n", "nm"},
+										Required: true,
+									},
+									&cli.BoolFlag{
+										Name:    "print",
+										Usage:   "print result of the operation",
+										Aliases: []string{"p", "pr"},
+									},
+								},
+							},
+							{
+								Name:   "order",
+								Usage:  "set the position of a group",
+								Action: locked(orderGroup),
+								Flags: []cli.Flag{
+									&cli.StringFlag{
+										Name:     "bucket",
+										Usage:    "the uuid of the bucket",
+										Aliases:  []string{"b", "bck"},
+										Required: true,
+									},
+									&cli.StringFlag{
+										Name:     "group",
+										Usage:    "the uuid or name of the group",
+										Aliases:  []string{"g", "grp"},
+										Required: true,
+									},
+									&cli.IntFlag{
+										Name:     "order",
+										Usage:    "the position of the group when listed",
+										Aliases:  []string{"o", "ord"},
+										Required: true,
+									},
+									&cli.BoolFlag{
+										Name:    "print",
+										Usage:   "print result of the operation",
+										Aliases: []string{"p", "pr"},
+									},
+								},
+							},
+							{
+								Name:   "remove",
+								Usage:  "remove a group, taking its links out of it",
+								Action: locked(removeGroup),
+								Flags: []cli.Flag{
+									&cli.StringFlag{
+										Name:     "bucket",
+										Usage:    "the uuid of the bucket",
+										Aliases:  []string{"b", "bck"},
+										Required: true,
+									},
+									&cli.StringFlag{
+										Name:     "group",
+										Usage:    "the uuid or name of the group",
+										Aliases:  []string{"g", "grp"},
+										Required: true,
+									},
+								},
+							},
 						},
 					},
 					{
@@ -321,7 +664,7 @@ func createApp() *cli.App {
 					{
 						Name:   "add",
 						Usage:  "add a link",
-						Action: addLink,
+						Action: locked(addLink),
 						Flags: []cli.Flag{
 							&cli.StringFlag{
 								Name:     "bucket",
@@ -343,14 +686,14 @@ func createApp() *cli.App {
 							},
 							&cli.StringFlag{
 								Name:    "group",
-								Usage:   "the group of the link",
+								Usage:   "the uuid or name of the group, created when it does not exist",
 								Aliases: []string{"g", "grp"},
 							},
-							// &cli.StringSliceFlag{
-							// 	Name:    "tags",
-							// 	Usage:   "the tags of the link",
-							// 	Aliases: []string{"tg", "tgs"},
-							// },
+							&cli.StringSliceFlag{
+								Name:    "tag",
+								Usage:   "a tag of the link, repeat for more than one",
+								Aliases: []string{"tg"},
+							},
 							&cli.BoolFlag{
 								Name:    "print",
 								Usage:   "print result of the operation",
@@ -361,7 +704,7 @@ func createApp() *cli.App {
 					{
 						Name:   "setgroup",
 						Usage:  "set the group for a link",
-						Action: setLinkGroup,
+						Action: locked(setLinkGroup),
 						Flags: []cli.Flag{
 							&cli.StringFlag{
 								Name:     "bucket",
@@ -377,7 +720,7 @@ func createApp() *cli.App {
 							},
 							&cli.StringFlag{
 								Name:     "group",
-								Usage:    "the group of the link",
+								Usage:    "the uuid or name of the group, created when it does not exist",
 								Aliases:  []string{"g", "grp"},
 								Required: true,
 							},
@@ -389,9 +732,9 @@ func createApp() *cli.App {
 						},
 					},
 					{
-						Name:   "unsetgroup",
-						Usage:  "unset the group for a link",
-						Action: unsetLinkGroup,
+						Name:   "edit",
+						Usage:  "edit the title, url or tags of a link",
+						Action: locked(editLink),
 						Flags: []cli.Flag{
 							&cli.StringFlag{
 								Name:     "bucket",
@@ -405,6 +748,26 @@ func createApp() *cli.App {
 								Aliases:  []string{"u", "uid"},
 								Required: true,
 							},
+							&cli.StringFlag{
+								Name:    "title",
+								Usage:   "the new title of the link",
+								Aliases: []string{"t", "ttl"},
+							},
+							&cli.StringFlag{
+								Name:    "url",
+								Usage:   "the new url of the link",
+								Aliases: []string{"ur"},
+							},
+							&cli.StringSliceFlag{
+								Name:    "add-tag",
+								Usage:   "a tag to add to the link",
+								Aliases: []string{"at"},
+							},
+							&cli.StringSliceFlag{
+								Name:    "remove-tag",
+								Usage:   "a tag to remove from the link",
+								Aliases: []string{"rt"},
+							},
 							&cli.BoolFlag{
 								Name:    "print",
 								Usage:   "print result of the operation",
@@ -413,9 +776,95 @@ func createApp() *cli.App {
 						},
 					},
 					{
-						Name:   "remove",
-						Usage:  "remove a link",
-						Action: removeLink,
+						Name:    "tag",
+						Aliases: []string{"tg"},
+						Usage:   "manage the tags of a link",
+						Subcommands: []*cli.Command{
+							{
+								Name:   "list",
+								Usage:  "list the tags of a link",
+								Action: listLinkTags,
+								Flags: []cli.Flag{
+									&cli.StringFlag{
+										Name:     "bucket",
+										Usage:    "the uuid of the bucket",
+										Aliases:  []string{"b", "bck"},
+										Required: true,
+									},
+									&cli.StringFlag{
+										Name:     "uuid",
+										Usage:    "the uuid of the link",
+										Aliases:  []string{"u", "uid"},
+										Required: true,
+									},
+								},
+							},
+							{
+								Name:   "add",
+								Usage:  "add tags to a link",
+								Action: locked(addLinkTags),
+								Flags: []cli.Flag{
+									&cli.StringFlag{
+										Name:     "bucket",
+										Usage:    "the uuid of the bucket",
+										Aliases:  []string{"b", "bck"},
+										Required: true,
+									},
+									&cli.StringFlag{
+										Name:     "uuid",
+										Usage:    "the uuid of the link",
+										Aliases:  []string{"u", "uid"},
+										Required: true,
+									},
+									&cli.StringSliceFlag{
+										Name:     "tag",
+										Usage:    "a tag, repeat for more than one",
+										Aliases:  []string{"tg"},
+										Required: true,
+									},
+									&cli.BoolFlag{
+										Name:    "print",
+										Usage:   "print result of the operation",
+										Aliases: []string{"p", "pr"},
+									},
+								},
+							},
+							{
+								Name:   "remove",
+								Usage:  "remove tags from a link",
+								Action: locked(removeLinkTags),
+								Flags: []cli.Flag{
+									&cli.StringFlag{
+										Name:     "bucket",
+										Usage:    "the uuid of the bucket",
+										Aliases:  []string{"b", "bck"},
+										Required: true,
+									},
+									&cli.StringFlag{
+										Name:     "uuid",
+										Usage:    "the uuid of the link",
+										Aliases:  []string{"u", "uid"},
+										Required: true,
+									},
+									&cli.StringSliceFlag{
+										Name:     "tag",
+										Usage:    "a tag, repeat for more than one",
+										Aliases:  []string{"tg"},
+										Required: true,
+									},
+									&cli.BoolFlag{
+										Name:    "print",
+										Usage:   "print result of the operation",
+										Aliases: []string{"p", "pr"},
+									},
+								},
+							},
+						},
+					},
+					{
+						Name:   "unsetgroup",
+						Usage:  "unset the group for a link",
+						Action: locked(unsetLinkGroup),
 						Flags: []cli.Flag{
 							&cli.StringFlag{
 								Name:     "bucket",
@@ -429,12 +878,17 @@ func createApp() *cli.App {
 								Aliases:  []string{"u", "uid"},
 								Required: true,
 							},
+							&cli.BoolFlag{
+								Name:    "print",
+								Usage:   "print result of the operation",
+								Aliases: []string{"p", "pr"},
+							},
 						},
 					},
 					{
-						Name:   "fix",
-						Usage:  "fix a link warning",
-						Action: fixLink,
+						Name:   "remove",
+						Usage:  "remove a link",
+						Action: locked(removeLink),
 						Flags: []cli.Flag{
 							&cli.StringFlag{
 								Name:     "bucket",
@@ -448,17 +902,38 @@ func createApp() *cli.App {
 								Aliases:  []string{"u", "uid"},
 								Required: true,
 							},
+						},
+					},
+					{
+						Name:   "fix",
+						Usage:  "fix link warnings and push the repaired links",
+						Action: locked(fixLink),
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:    "bucket",
+								Usage:   "the uuid of the bucket, fixing every link in it when no uuid is given",
+								Aliases: []string{"b", "bck"},
+							},
 							&cli.StringFlag{
-								Name:     "warning",
-								Usage:    "the warning to fix",
-								Aliases:  []string{"w", "war"},
-								Required: true,
+								Name:    "uuid",
+								Usage:   "the uuid of the link",
+								Aliases: []string{"u", "uid"},
+							},
+							&cli.StringFlag{
+								Name:    "warning",
+								Usage:   "the warning to fix, every warning of the link when omitted",
+								Aliases: []string{"w", "war"},
 							},
 							&cli.StringFlag{
 								Name:    "tag",
 								Usage:   "the tag the warning applies to",
 								Aliases: []string{"t", "tg"},
 							},
+							&cli.BoolFlag{
+								Name:    "all",
+								Usage:   "fix every link in every bucket",
+								Aliases: []string{"a"},
+							},
 							&cli.BoolFlag{
 								Name:    "print",
 								Usage:   "print result of the operation",
@@ -500,6 +975,88 @@ func createApp() *cli.App {
 					},
 				},
 			},
+			{
+				Name:    "tags",
+				Aliases: []string{"t", "tag"},
+				Usage:   "inspect tags",
+				Subcommands: []*cli.Command{
+					{
+						Name:   "list",
+						Usage:  "list the user tags of a store or bucket with their counts",
+						Action: listTags,
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:    "bucket",
+								Usage:   "the uuid of the bucket, all buckets when omitted",
+								Aliases: []string{"b", "bck"},
+							},
+						},
+					},
+				},
+			},
+			{
+				Name:  "sync",
+				Usage: "synchronise queued changes with pinboard",
+				Subcommands: []*cli.Command{
+					{
+						Name:   "push",
+						Usage:  "push queued changes to pinboard",
+						Action: locked(pushSync),
+					},
+					{
+						Name:   "status",
+						Usage:  "show changes that have not been pushed",
+						Action: statusSync,
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:    "json",
+								Usage:   "show the queue as json",
+								Aliases: []string{"j"},
+							},
+						},
+					},
+				},
+			},
+			{
+				Name:      "refresh",
+				Usage:     "refresh several stores, or some of their buckets, from pinboard at once",
+				ArgsUsage: "[<store file>...]",
+				Action:    locked(refreshAll),
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:    "all",
+						Usage:   "refresh every store, the one at --path and those given as arguments",
+						Aliases: []string{"a"},
+					},
+					&cli.StringSliceFlag{
+						Name:    "bucket",
+						Usage:   "the uuid of a bucket to refresh, may be repeated",
+						Aliases: []string{"b", "bkt"},
+					},
+					&cli.IntFlag{
+						Name:    "workers",
+						Usage:   "how many stores or buckets to refresh at once",
+						Aliases: []string{"w"},
+						Value:   pindb.DefaultWorkers,
+					},
+					&cli.BoolFlag{
+						Name:    "force",
+						Usage:   "force the refresh",
+						Aliases: []string{"f", "frc"},
+					},
+					&cli.BoolFlag{
+						Name:    "report",
+						Usage:   "print the links that were added, removed or changed",
+						Aliases: []string{"r", "rep"},
+					},
+					&cli.StringFlag{
+						Name:    "format",
+						Usage:   "the report format, text or json",
+						Aliases: []string{"fmt"},
+						Value:   "text",
+					},
+				},
+			},
 		},
 	}
 
@@ -3,6 +3,7 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"os"
 	"strings"
 
 	"github.com/google/uuid"
@@ -11,38 +12,38 @@ import (
 )
 
 func listBuckets(cCtx *cli.Context) error {
-	pdb := pindb.New()
+	pdb := newClient(cCtx)
 	path := cCtx.String("path")
 	passphrase := cCtx.String("passphrase")
 
 	var store *pindb.Store
 	var err error
 	if strings.TrimSpace(passphrase) == "" {
-		store, err = pdb.Read(path)
+		store, err = readPath(pdb, path)
 	} else {
-		store, err = pdb.ReadEncrypted(path, passphrase)
+		store, err = readEncryptedPath(pdb, path, passphrase)
 	}
 
 	if err != nil {
 		return err
 	}
 
-	printBuckets(store.Buckets(), cCtx.Bool("include-links"))
+	printBuckets(os.Stdout, store.Buckets(), cCtx.Bool("include-links"))
 
 	return nil
 }
 
 func readBucket(cCtx *cli.Context) error {
-	pdb := pindb.New()
+	pdb := newClient(cCtx)
 	path := cCtx.String("path")
 	passphrase := cCtx.String("passphrase")
 
 	var store *pindb.Store
 	var err error
 	if strings.TrimSpace(passphrase) == "" {
-		store, err = pdb.Read(path)
+		store, err = readPath(pdb, path)
 	} else {
-		store, err = pdb.ReadEncrypted(path, passphrase)
+		store, err = readEncryptedPath(pdb, path, passphrase)
 	}
 
 	if err != nil {
@@ -59,22 +60,22 @@ func readBucket(cCtx *cli.Context) error {
 		return err
 	}
 
-	printBucket(b, cCtx.Bool("include-links"))
+	printBucket(os.Stdout, b, cCtx.Bool("include-links"))
 
 	return nil
 }
 
 func addBucket(cCtx *cli.Context) error {
-	pdb := pindb.New()
+	pdb := newClient(cCtx)
 	path := cCtx.String("path")
 	passphrase := cCtx.String("passphrase")
 
 	var store *pindb.Store
 	var err error
 	if strings.TrimSpace(passphrase) == "" {
-		store, err = pdb.Read(path)
+		store, err = readPath(pdb, path)
 	} else {
-		store, err = pdb.ReadEncrypted(path, passphrase)
+		store, err = readEncryptedPath(pdb, path, passphrase)
 	}
 
 	if err != nil {
@@ -88,9 +89,9 @@ func addBucket(cCtx *cli.Context) error {
 	}
 
 	if strings.TrimSpace(passphrase) == "" {
-		err = store.Write(path)
+		err = writePath(store, path)
 	} else {
-		err = store.WriteEncrypted(path, passphrase)
+		err = writeEncryptedPath(store, path, passphrase)
 	}
 
 	if err != nil {
@@ -98,23 +99,23 @@ func addBucket(cCtx *cli.Context) error {
 	}
 
 	if cCtx.Bool("print") {
-		printBucket(b, false)
+		printBucket(statusOutput(path), b, false)
 	}
 
 	return nil
 }
 
 func renameBucket(cCtx *cli.Context) error {
-	pdb := pindb.New()
+	pdb := newClient(cCtx)
 	path := cCtx.String("path")
 	passphrase := cCtx.String("passphrase")
 
 	var store *pindb.Store
 	var err error
 	if strings.TrimSpace(passphrase) == "" {
-		store, err = pdb.Read(path)
+		store, err = readPath(pdb, path)
 	} else {
-		store, err = pdb.ReadEncrypted(path, passphrase)
+		store, err = readEncryptedPath(pdb, path, passphrase)
 	}
 
 	if err != nil {
@@ -135,9 +136,9 @@ func renameBucket(cCtx *cli.Context) error {
 	b = b.Rename(name)
 
 	if strings.TrimSpace(passphrase) == "" {
-		err = store.Write(path)
+		err = writePath(store, path)
 	} else {
-		err = store.WriteEncrypted(path, passphrase)
+		err = writeEncryptedPath(store, path, passphrase)
 	}
 
 	if err != nil {
@@ -145,23 +146,23 @@ func renameBucket(cCtx *cli.Context) error {
 	}
 
 	if cCtx.Bool("print") {
-		printBucket(b, false)
+		printBucket(statusOutput(path), b, false)
 	}
 
 	return nil
 }
 
 func removeBucket(cCtx *cli.Context) error {
-	pdb := pindb.New()
+	pdb := newClient(cCtx)
 	path := cCtx.String("path")
 	passphrase := cCtx.String("passphrase")
 
 	var store *pindb.Store
 	var err error
 	if strings.TrimSpace(passphrase) == "" {
-		store, err = pdb.Read(path)
+		store, err = readPath(pdb, path)
 	} else {
-		store, err = pdb.ReadEncrypted(path, passphrase)
+		store, err = readEncryptedPath(pdb, path, passphrase)
 	}
 
 	if err != nil {
@@ -180,15 +181,32 @@ func removeBucket(cCtx *cli.Context) error {
 
 	remLinks := cCtx.Bool("remove-links")
 	remTags := cCtx.Bool("remove-tags")
-	_, err = b.Remove(remLinks, remTags)
+
+	// deleting tags cannot be staged, deleting links can so that a failure
+	// part way leaves every link in place
+	if remLinks && !remTags {
+		tx, err := store.Begin()
+		if err != nil {
+			return err
+		}
+
+		_, err = b.RemoveContext(cCtx.Context, remLinks, remTags)
+		if err != nil {
+			return err
+		}
+
+		return commitPath(cCtx, tx, path, passphrase)
+	}
+
+	_, err = b.RemoveContext(cCtx.Context, remLinks, remTags)
 	if err != nil {
 		return err
 	}
 
 	if strings.TrimSpace(passphrase) == "" {
-		err = store.Write(path)
+		err = writePath(store, path)
 	} else {
-		err = store.WriteEncrypted(path, passphrase)
+		err = writeEncryptedPath(store, path, passphrase)
 	}
 
 	if err != nil {
@@ -199,16 +217,16 @@ func removeBucket(cCtx *cli.Context) error {
 }
 
 func refreshBucket(cCtx *cli.Context) error {
-	pdb := pindb.New()
+	pdb := newClient(cCtx)
 	path := cCtx.String("path")
 	passphrase := cCtx.String("passphrase")
 
 	var store *pindb.Store
 	var err error
 	if strings.TrimSpace(passphrase) == "" {
-		store, err = pdb.Read(path)
+		store, err = readPath(pdb, path)
 	} else {
-		store, err = pdb.ReadEncrypted(path, passphrase)
+		store, err = readEncryptedPath(pdb, path, passphrase)
 	}
 
 	if err != nil {
@@ -226,35 +244,48 @@ func refreshBucket(cCtx *cli.Context) error {
 	}
 
 	force := cCtx.Bool("force")
-	_, err = b.Refresh(force)
+	if cCtx.Bool("dry-run") {
+		r, err := b.PreviewContext(cCtx.Context, force)
+		if err != nil {
+			return err
+		}
+
+		return printRefreshResult(os.Stdout, r, cCtx.String("format"))
+	}
+
+	r, err := b.RefreshContext(cCtx.Context, force)
 	if err != nil {
 		return err
 	}
 
 	if strings.TrimSpace(passphrase) == "" {
-		err = store.Write(path)
+		err = writePath(store, path)
 	} else {
-		err = store.WriteEncrypted(path, passphrase)
+		err = writeEncryptedPath(store, path, passphrase)
 	}
 
 	if err != nil {
 		return err
 	}
 
+	if cCtx.Bool("report") {
+		return printRefreshResult(statusOutput(path), r, cCtx.String("format"))
+	}
+
 	return nil
 }
 
 func listJsonBuckets(cCtx *cli.Context) error {
-	pdb := pindb.New()
+	pdb := newClient(cCtx)
 	path := cCtx.String("path")
 	passphrase := cCtx.String("passphrase")
 
 	var store *pindb.Store
 	var err error
 	if strings.TrimSpace(passphrase) == "" {
-		store, err = pdb.Read(path)
+		store, err = readPath(pdb, path)
 	} else {
-		store, err = pdb.ReadEncrypted(path, passphrase)
+		store, err = readEncryptedPath(pdb, path, passphrase)
 	}
 
 	if err != nil {
@@ -279,16 +310,16 @@ func listJsonBuckets(cCtx *cli.Context) error {
 }
 
 func jsonBucket(cCtx *cli.Context) error {
-	pdb := pindb.New()
+	pdb := newClient(cCtx)
 	path := cCtx.String("path")
 	passphrase := cCtx.String("passphrase")
 
 	var store *pindb.Store
 	var err error
 	if strings.TrimSpace(passphrase) == "" {
-		store, err = pdb.Read(path)
+		store, err = readPath(pdb, path)
 	} else {
-		store, err = pdb.ReadEncrypted(path, passphrase)
+		store, err = readEncryptedPath(pdb, path, passphrase)
 	}
 
 	if err != nil {
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/tmstn/pindb"
+	"github.com/urfave/cli/v2"
+)
+
+func newClient(cCtx *cli.Context) *pindb.Client {
+	opts := []pindb.Option{}
+	if cCtx.Bool("offline") {
+		opts = append(opts, pindb.WithOffline())
+	}
+
+	opts = append(opts, pindb.WithHistory(cCtx.Int("history")))
+	opts = append(opts, pindb.WithRateLimit(cCtx.Duration("rate-limit")))
+	opts = append(opts, pindb.WithRecentRateLimit(cCtx.Duration("recent-rate-limit")))
+	opts = append(opts, pindb.WithAllRateLimit(cCtx.Duration("all-rate-limit")))
+	opts = append(opts, pindb.WithRetries(cCtx.Int("retries"), cCtx.Duration("backoff")))
+	if cCtx.Bool("verbose") {
+		opts = append(opts, pindb.WithLogger(log.New(os.Stderr, "", log.Ltime)))
+	}
+
+	return pindb.New(opts...)
+}
+
+// applied reports whether a change was made to the store, including one
+// that could not be pushed and stays queued. The store is still written
+// before the push error is returned.
+func applied(err error) bool {
+	return err == nil || errors.Is(err, pindb.ErrQueued)
+}
+
+// readPath reads the store at path, or from stdin when path is "-".
+func readPath(pdb *pindb.Client, path string) (*pindb.Store, error) {
+	if path == "-" {
+		return pdb.ReadStream(os.Stdin)
+	}
+	return pdb.Read(path)
+}
+
+func readEncryptedPath(pdb *pindb.Client, path, passphrase string) (*pindb.Store, error) {
+	if path == "-" {
+		return pdb.ReadEncryptedStream(os.Stdin, passphrase)
+	}
+	return pdb.ReadEncrypted(path, passphrase)
+}
+
+// statusOutput is where a command that writes the store to path prints, so
+// that a store written to stdout is not mixed with anything else.
+func statusOutput(path string) io.Writer {
+	if path == "-" {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// writePath writes the store to path, or to stdout when path is "-".
+func writePath(store *pindb.Store, path string) error {
+	if path == "-" {
+		_, err := store.WriteTo(os.Stdout)
+		return err
+	}
+	return store.Write(path)
+}
+
+// commitPath commits tx and writes the store to path, or to stdout when
+// path is "-".
+func commitPath(cCtx *cli.Context, tx *pindb.Tx, path, passphrase string) error {
+	if path == "-" {
+		if strings.TrimSpace(passphrase) == "" {
+			return tx.CommitToContext(cCtx.Context, os.Stdout)
+		}
+		return tx.CommitEncryptedToContext(cCtx.Context, os.Stdout, passphrase)
+	}
+
+	if strings.TrimSpace(passphrase) == "" {
+		return tx.CommitContext(cCtx.Context, path)
+	}
+	return tx.CommitEncryptedContext(cCtx.Context, path, passphrase)
+}
+
+func writeEncryptedPath(store *pindb.Store, path, passphrase string) error {
+	if path == "-" {
+		_, err := store.WriteEncryptedTo(os.Stdout, passphrase)
+		return err
+	}
+	return store.WriteEncrypted(path, passphrase)
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/tmstn/pindb"
+	"github.com/urfave/cli/v2"
+)
+
+func findOrAddGroup(b *pindb.Bucket, key string) (*pindb.Group, error) {
+	g, err := b.FindGroup(key)
+	if err == nil {
+		return g, nil
+	}
+
+	return b.AddGroup(key)
+}
+
+func listGroups(cCtx *cli.Context) error {
+	pdb := newClient(cCtx)
+	path := cCtx.String("path")
+	passphrase := cCtx.String("passphrase")
+
+	var store *pindb.Store
+	var err error
+	if strings.TrimSpace(passphrase) == "" {
+		store, err = readPath(pdb, path)
+	} else {
+		store, err = readEncryptedPath(pdb, path, passphrase)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	bid, err := uuid.Parse(cCtx.String("bucket"))
+	if err != nil {
+		return err
+	}
+
+	b, err := store.Bucket(bid)
+	if err != nil {
+		return err
+	}
+
+	printGroups(os.Stdout, b.Groups())
+
+	return nil
+}
+
+func addGroup(cCtx *cli.Context) error {
+	pdb := newClient(cCtx)
+	path := cCtx.String("path")
+	passphrase := cCtx.String("passphrase")
+
+	var store *pindb.Store
+	var err error
+	if strings.TrimSpace(passphrase) == "" {
+		store, err = readPath(pdb, path)
+	} else {
+		store, err = readEncryptedPath(pdb, path, passphrase)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	bid, err := uuid.Parse(cCtx.String("bucket"))
+	if err != nil {
+		return err
+	}
+
+	b, err := store.Bucket(bid)
+	if err != nil {
+		return err
+	}
+
+	g, err := b.AddGroup(cCtx.String("name"))
+	if err != nil {
+		return err
+	}
+
+	if cCtx.IsSet("order") {
+		g = g.SetOrder(cCtx.Int("order"))
+	}
+
+	if strings.TrimSpace(passphrase) == "" {
+		err = writePath(store, path)
+	} else {
+		err = writeEncryptedPath(store, path, passphrase)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if cCtx.Bool("print") {
+		printGroup(statusOutput(path), g)
+	}
+
+	return nil
+}
+
+func renameGroup(cCtx *cli.Context) error {
+	pdb := newClient(cCtx)
+	path := cCtx.String("path")
+	passphrase := cCtx.String("passphrase")
+
+	var store *pindb.Store
+	var err error
+	if strings.TrimSpace(passphrase) == "" {
+		store, err = readPath(pdb, path)
+	} else {
+		store, err = readEncryptedPath(pdb, path, passphrase)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	bid, err := uuid.Parse(cCtx.String("bucket"))
+	if err != nil {
+		return err
+	}
+
+	b, err := store.Bucket(bid)
+	if err != nil {
+		return err
+	}
+
+	g, err := b.FindGroup(cCtx.String("group"))
+	if err != nil {
+		return err
+	}
+
+	g, err = g.Rename(cCtx.String("name"))
+	if err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(passphrase) == "" {
+		err = writePath(store, path)
+	} else {
+		err = writeEncryptedPath(store, path, passphrase)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if cCtx.Bool("print") {
+		printGroup(statusOutput(path), g)
+	}
+
+	return nil
+}
+
+func orderGroup(cCtx *cli.Context) error {
+	pdb := newClient(cCtx)
+	path := cCtx.String("path")
+	passphrase := cCtx.String("passphrase")
+
+	var store *pindb.Store
+	var err error
+	if strings.TrimSpace(passphrase) == "" {
+		store, err = readPath(pdb, path)
+	} else {
+		store, err = readEncryptedPath(pdb, path, passphrase)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	bid, err := uuid.Parse(cCtx.String("bucket"))
+	if err != nil {
+		return err
+	}
+
+	b, err := store.Bucket(bid)
+	if err != nil {
+		return err
+	}
+
+	g, err := b.FindGroup(cCtx.String("group"))
+	if err != nil {
+		return err
+	}
+
+	g = g.SetOrder(cCtx.Int("order"))
+
+	if strings.TrimSpace(passphrase) == "" {
+		err = writePath(store, path)
+	} else {
+		err = writeEncryptedPath(store, path, passphrase)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if cCtx.Bool("print") {
+		printGroup(statusOutput(path), g)
+	}
+
+	return nil
+}
+
+func removeGroup(cCtx *cli.Context) error {
+	pdb := newClient(cCtx)
+	path := cCtx.String("path")
+	passphrase := cCtx.String("passphrase")
+
+	var store *pindb.Store
+	var err error
+	if strings.TrimSpace(passphrase) == "" {
+		store, err = readPath(pdb, path)
+	} else {
+		store, err = readEncryptedPath(pdb, path, passphrase)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	bid, err := uuid.Parse(cCtx.String("bucket"))
+	if err != nil {
+		return err
+	}
+
+	b, err := store.Bucket(bid)
+	if err != nil {
+		return err
+	}
+
+	g, err := b.FindGroup(cCtx.String("group"))
+	if err != nil {
+		return err
+	}
+
+	perr := g.RemoveContext(cCtx.Context)
+	if !applied(perr) {
+		return perr
+	}
+
+	if strings.TrimSpace(passphrase) == "" {
+		err = writePath(store, path)
+	} else {
+		err = writeEncryptedPath(store, path, passphrase)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	printPending(statusOutput(path), store)
+
+	return perr
+}
@@ -2,8 +2,10 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/url"
+	"os"
 	"strings"
 
 	"github.com/google/uuid"
@@ -12,16 +14,16 @@ import (
 )
 
 func listLinks(cCtx *cli.Context) error {
-	pdb := pindb.New()
+	pdb := newClient(cCtx)
 	path := cCtx.String("path")
 	passphrase := cCtx.String("passphrase")
 
 	var store *pindb.Store
 	var err error
 	if strings.TrimSpace(passphrase) == "" {
-		store, err = pdb.Read(path)
+		store, err = readPath(pdb, path)
 	} else {
-		store, err = pdb.ReadEncrypted(path, passphrase)
+		store, err = readEncryptedPath(pdb, path, passphrase)
 	}
 
 	if err != nil {
@@ -38,22 +40,22 @@ func listLinks(cCtx *cli.Context) error {
 		return err
 	}
 
-	printLinks(b.Links())
+	printLinks(os.Stdout, b.Links())
 
 	return nil
 }
 
 func readLink(cCtx *cli.Context) error {
-	pdb := pindb.New()
+	pdb := newClient(cCtx)
 	path := cCtx.String("path")
 	passphrase := cCtx.String("passphrase")
 
 	var store *pindb.Store
 	var err error
 	if strings.TrimSpace(passphrase) == "" {
-		store, err = pdb.Read(path)
+		store, err = readPath(pdb, path)
 	} else {
-		store, err = pdb.ReadEncrypted(path, passphrase)
+		store, err = readEncryptedPath(pdb, path, passphrase)
 	}
 
 	if err != nil {
@@ -80,22 +82,22 @@ func readLink(cCtx *cli.Context) error {
 		return err
 	}
 
-	printLink(l)
+	printLink(os.Stdout, l)
 
 	return nil
 }
 
 func addLink(cCtx *cli.Context) error {
-	pdb := pindb.New()
+	pdb := newClient(cCtx)
 	path := cCtx.String("path")
 	passphrase := cCtx.String("passphrase")
 
 	var store *pindb.Store
 	var err error
 	if strings.TrimSpace(passphrase) == "" {
-		store, err = pdb.Read(path)
+		store, err = readPath(pdb, path)
 	} else {
-		store, err = pdb.ReadEncrypted(path, passphrase)
+		store, err = readEncryptedPath(pdb, path, passphrase)
 	}
 
 	if err != nil {
@@ -114,47 +116,59 @@ func addLink(cCtx *cli.Context) error {
 
 	title := cCtx.String("title")
 	urls := cCtx.String("url")
-	group := pindb.NewTag(cCtx.String("group"))
 	tags := []pindb.Tag{}
+	for _, t := range cCtx.StringSlice("tag") {
+		tags = append(tags, pindb.NewTag(t))
+	}
 
 	u, err := url.Parse(urls)
 	if err != nil {
 		return err
 	}
 
-	l, err := b.Add(title, u, group, tags...)
-	if err != nil {
-		return err
+	var group *pindb.Group
+	if strings.TrimSpace(cCtx.String("group")) != "" {
+		group, err = findOrAddGroup(b, cCtx.String("group"))
+		if err != nil {
+			return err
+		}
+	}
+
+	l, perr := b.AddContext(cCtx.Context, title, u, group, tags...)
+	if !applied(perr) {
+		return perr
 	}
 
 	if strings.TrimSpace(passphrase) == "" {
-		err = store.Write(path)
+		err = writePath(store, path)
 	} else {
-		err = store.WriteEncrypted(path, passphrase)
+		err = writeEncryptedPath(store, path, passphrase)
 	}
 
 	if err != nil {
 		return err
 	}
 
+	printPending(statusOutput(path), store)
+
 	if cCtx.Bool("print") {
-		printLink(l)
+		printLink(statusOutput(path), l)
 	}
 
-	return nil
+	return perr
 }
 
 func setLinkGroup(cCtx *cli.Context) error {
-	pdb := pindb.New()
+	pdb := newClient(cCtx)
 	path := cCtx.String("path")
 	passphrase := cCtx.String("passphrase")
 
 	var store *pindb.Store
 	var err error
 	if strings.TrimSpace(passphrase) == "" {
-		store, err = pdb.Read(path)
+		store, err = readPath(pdb, path)
 	} else {
-		store, err = pdb.ReadEncrypted(path, passphrase)
+		store, err = readEncryptedPath(pdb, path, passphrase)
 	}
 
 	if err != nil {
@@ -181,40 +195,146 @@ func setLinkGroup(cCtx *cli.Context) error {
 		return err
 	}
 
-	group := pindb.NewTag(cCtx.String("group"))
-	l, err = l.SetGroup(group)
+	group, err := findOrAddGroup(b, cCtx.String("group"))
 	if err != nil {
 		return err
 	}
 
+	l, perr := l.SetGroupContext(cCtx.Context, group)
+	if !applied(perr) {
+		return perr
+	}
+
 	if strings.TrimSpace(passphrase) == "" {
-		err = store.Write(path)
+		err = writePath(store, path)
 	} else {
-		err = store.WriteEncrypted(path, passphrase)
+		err = writeEncryptedPath(store, path, passphrase)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	printPending(statusOutput(path), store)
+
+	if cCtx.Bool("print") {
+		printLink(statusOutput(path), l)
+	}
+
+	return perr
+}
+
+func editLink(cCtx *cli.Context) error {
+	pdb := newClient(cCtx)
+	path := cCtx.String("path")
+	passphrase := cCtx.String("passphrase")
+
+	var store *pindb.Store
+	var err error
+	if strings.TrimSpace(passphrase) == "" {
+		store, err = readPath(pdb, path)
+	} else {
+		store, err = readEncryptedPath(pdb, path, passphrase)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	bid, err := uuid.Parse(cCtx.String("bucket"))
+	if err != nil {
+		return err
+	}
+
+	b, err := store.Bucket(bid)
+	if err != nil {
+		return err
+	}
+
+	id, err := uuid.Parse(cCtx.String("uuid"))
+	if err != nil {
+		return err
+	}
+
+	l, err := b.Link(id)
+	if err != nil {
+		return err
 	}
 
+	// the edits reach pinboard and the store file together or not at all
+	tx, err := store.Begin()
 	if err != nil {
 		return err
 	}
 
+	if cCtx.IsSet("title") {
+		l, err = l.SetTitleContext(cCtx.Context, cCtx.String("title"))
+		if err != nil {
+			return err
+		}
+	}
+
+	if cCtx.IsSet("url") {
+		u, err := url.Parse(cCtx.String("url"))
+		if err != nil {
+			return err
+		}
+
+		l, err = l.SetURLContext(cCtx.Context, u)
+		if err != nil {
+			return err
+		}
+	}
+
+	if cCtx.IsSet("add-tag") {
+		tags := []pindb.Tag{}
+		for _, t := range cCtx.StringSlice("add-tag") {
+			tags = append(tags, pindb.NewTag(t))
+		}
+
+		l, err = l.AddTagsContext(cCtx.Context, tags...)
+		if err != nil {
+			return err
+		}
+	}
+
+	if cCtx.IsSet("remove-tag") {
+		tags := []pindb.Tag{}
+		for _, t := range cCtx.StringSlice("remove-tag") {
+			tags = append(tags, pindb.NewTag(t))
+		}
+
+		l, err = l.RemoveTagsContext(cCtx.Context, tags...)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = commitPath(cCtx, tx, path, passphrase)
+	if err != nil {
+		return err
+	}
+
+	printPending(statusOutput(path), store)
+
 	if cCtx.Bool("print") {
-		printLink(l)
+		printLink(statusOutput(path), l)
 	}
 
 	return nil
 }
 
-func unsetLinkGroup(cCtx *cli.Context) error {
-	pdb := pindb.New()
+func listLinkTags(cCtx *cli.Context) error {
+	pdb := newClient(cCtx)
 	path := cCtx.String("path")
 	passphrase := cCtx.String("passphrase")
 
 	var store *pindb.Store
 	var err error
 	if strings.TrimSpace(passphrase) == "" {
-		store, err = pdb.Read(path)
+		store, err = readPath(pdb, path)
 	} else {
-		store, err = pdb.ReadEncrypted(path, passphrase)
+		store, err = readEncryptedPath(pdb, path, passphrase)
 	}
 
 	if err != nil {
@@ -241,39 +361,90 @@ func unsetLinkGroup(cCtx *cli.Context) error {
 		return err
 	}
 
-	l, err = l.UnsetGroup()
+	for _, t := range l.Tags(false) {
+		fmt.Println(t)
+	}
+
+	return nil
+}
+
+func addLinkTags(cCtx *cli.Context) error {
+	pdb := newClient(cCtx)
+	path := cCtx.String("path")
+	passphrase := cCtx.String("passphrase")
+
+	var store *pindb.Store
+	var err error
+	if strings.TrimSpace(passphrase) == "" {
+		store, err = readPath(pdb, path)
+	} else {
+		store, err = readEncryptedPath(pdb, path, passphrase)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	bid, err := uuid.Parse(cCtx.String("bucket"))
+	if err != nil {
+		return err
+	}
+
+	b, err := store.Bucket(bid)
+	if err != nil {
+		return err
+	}
+
+	id, err := uuid.Parse(cCtx.String("uuid"))
 	if err != nil {
 		return err
 	}
 
+	l, err := b.Link(id)
+	if err != nil {
+		return err
+	}
+
+	tags := []pindb.Tag{}
+	for _, t := range cCtx.StringSlice("tag") {
+		tags = append(tags, pindb.NewTag(t))
+	}
+
+	l, perr := l.AddTagsContext(cCtx.Context, tags...)
+	if !applied(perr) {
+		return perr
+	}
+
 	if strings.TrimSpace(passphrase) == "" {
-		err = store.Write(path)
+		err = writePath(store, path)
 	} else {
-		err = store.WriteEncrypted(path, passphrase)
+		err = writeEncryptedPath(store, path, passphrase)
 	}
 
 	if err != nil {
 		return err
 	}
 
+	printPending(statusOutput(path), store)
+
 	if cCtx.Bool("print") {
-		printLink(l)
+		printLink(statusOutput(path), l)
 	}
 
-	return nil
+	return perr
 }
 
-func removeLink(cCtx *cli.Context) error {
-	pdb := pindb.New()
+func removeLinkTags(cCtx *cli.Context) error {
+	pdb := newClient(cCtx)
 	path := cCtx.String("path")
 	passphrase := cCtx.String("passphrase")
 
 	var store *pindb.Store
 	var err error
 	if strings.TrimSpace(passphrase) == "" {
-		store, err = pdb.Read(path)
+		store, err = readPath(pdb, path)
 	} else {
-		store, err = pdb.ReadEncrypted(path, passphrase)
+		store, err = readEncryptedPath(pdb, path, passphrase)
 	}
 
 	if err != nil {
@@ -300,35 +471,107 @@ func removeLink(cCtx *cli.Context) error {
 		return err
 	}
 
-	err = l.Remove()
+	tags := []pindb.Tag{}
+	for _, t := range cCtx.StringSlice("tag") {
+		tags = append(tags, pindb.NewTag(t))
+	}
+
+	l, perr := l.RemoveTagsContext(cCtx.Context, tags...)
+	if !applied(perr) {
+		return perr
+	}
+
+	if strings.TrimSpace(passphrase) == "" {
+		err = writePath(store, path)
+	} else {
+		err = writeEncryptedPath(store, path, passphrase)
+	}
+
 	if err != nil {
 		return err
 	}
 
+	printPending(statusOutput(path), store)
+
+	if cCtx.Bool("print") {
+		printLink(statusOutput(path), l)
+	}
+
+	return perr
+}
+
+func unsetLinkGroup(cCtx *cli.Context) error {
+	pdb := newClient(cCtx)
+	path := cCtx.String("path")
+	passphrase := cCtx.String("passphrase")
+
+	var store *pindb.Store
+	var err error
 	if strings.TrimSpace(passphrase) == "" {
-		err = store.Write(path)
+		store, err = readPath(pdb, path)
 	} else {
-		err = store.WriteEncrypted(path, passphrase)
+		store, err = readEncryptedPath(pdb, path, passphrase)
 	}
 
 	if err != nil {
 		return err
 	}
 
-	return nil
+	bid, err := uuid.Parse(cCtx.String("bucket"))
+	if err != nil {
+		return err
+	}
+
+	b, err := store.Bucket(bid)
+	if err != nil {
+		return err
+	}
+
+	id, err := uuid.Parse(cCtx.String("uuid"))
+	if err != nil {
+		return err
+	}
+
+	l, err := b.Link(id)
+	if err != nil {
+		return err
+	}
+
+	l, perr := l.UnsetGroupContext(cCtx.Context)
+	if !applied(perr) {
+		return perr
+	}
+
+	if strings.TrimSpace(passphrase) == "" {
+		err = writePath(store, path)
+	} else {
+		err = writeEncryptedPath(store, path, passphrase)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	printPending(statusOutput(path), store)
+
+	if cCtx.Bool("print") {
+		printLink(statusOutput(path), l)
+	}
+
+	return perr
 }
 
-func fixLink(cCtx *cli.Context) error {
-	pdb := pindb.New()
+func removeLink(cCtx *cli.Context) error {
+	pdb := newClient(cCtx)
 	path := cCtx.String("path")
 	passphrase := cCtx.String("passphrase")
 
 	var store *pindb.Store
 	var err error
 	if strings.TrimSpace(passphrase) == "" {
-		store, err = pdb.Read(path)
+		store, err = readPath(pdb, path)
 	} else {
-		store, err = pdb.ReadEncrypted(path, passphrase)
+		store, err = readEncryptedPath(pdb, path, passphrase)
 	}
 
 	if err != nil {
@@ -355,60 +598,172 @@ func fixLink(cCtx *cli.Context) error {
 		return err
 	}
 
-	var warning pindb.WarningCategory
-	var tag *pindb.Tag
-	switch cCtx.String("warning") {
-	case "mismatch_record":
-		warning = pindb.MismatchRecordWarning
-	case "no_uuid":
-		warning = pindb.NoUUIDWarning
-	case "mismatch_uuid":
-		warning = pindb.MismatchUUIDWarning
-	case "multiple_pindb_group_tag":
-		warning = pindb.MultiplePinDBGroupTagWarning
-	case "unrelated_pindb_group_tag":
-		warning = pindb.UnrelatedPinDBGroupTagWarning
-	case "unrelated_pindb_store_tag":
-		warning = pindb.UnrelatedPinDBStoreTagWarning
-	case "unrelated_pindb_bucket_tag":
-		warning = pindb.UnrelatedPinDBBucketTagWarning
-	default:
-		return fmt.Errorf("unknown warning: %s", cCtx.String("warning"))
+	perr := l.RemoveContext(cCtx.Context)
+	if !applied(perr) {
+		return perr
+	}
+
+	if strings.TrimSpace(passphrase) == "" {
+		err = writePath(store, path)
+	} else {
+		err = writeEncryptedPath(store, path, passphrase)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	printPending(statusOutput(path), store)
+
+	return perr
+}
+
+func fixLink(cCtx *cli.Context) error {
+	pdb := newClient(cCtx)
+	path := cCtx.String("path")
+	passphrase := cCtx.String("passphrase")
+
+	var store *pindb.Store
+	var err error
+	if strings.TrimSpace(passphrase) == "" {
+		store, err = readPath(pdb, path)
+	} else {
+		store, err = readEncryptedPath(pdb, path, passphrase)
 	}
 
-	l, err = l.Fix(pindb.NewWarning(warning, tag))
 	if err != nil {
 		return err
 	}
 
+	links := []*pindb.Link{}
+	if cCtx.Bool("all") {
+		for _, b := range store.Buckets() {
+			links = append(links, b.Links()...)
+		}
+	} else {
+		if strings.TrimSpace(cCtx.String("bucket")) == "" {
+			return errors.New("either --bucket or --all is required")
+		}
+
+		bid, err := uuid.Parse(cCtx.String("bucket"))
+		if err != nil {
+			return err
+		}
+
+		b, err := store.Bucket(bid)
+		if err != nil {
+			return err
+		}
+
+		if strings.TrimSpace(cCtx.String("uuid")) == "" {
+			links = b.Links()
+		} else {
+			id, err := uuid.Parse(cCtx.String("uuid"))
+			if err != nil {
+				return err
+			}
+
+			l, err := b.Link(id)
+			if err != nil {
+				return err
+			}
+
+			links = append(links, l)
+		}
+	}
+
+	var warning *pindb.Warning
+	if cCtx.IsSet("warning") {
+		var category pindb.WarningCategory
+		switch cCtx.String("warning") {
+		case "mismatch_record":
+			category = pindb.MismatchRecordWarning
+		case "no_uuid":
+			category = pindb.NoUUIDWarning
+		case "mismatch_uuid":
+			category = pindb.MismatchUUIDWarning
+		case "multiple_pindb_group_tag":
+			category = pindb.MultiplePinDBGroupTagWarning
+		case "unrelated_pindb_group_tag":
+			category = pindb.UnrelatedPinDBGroupTagWarning
+		case "unrelated_pindb_store_tag":
+			category = pindb.UnrelatedPinDBStoreTagWarning
+		case "unrelated_pindb_bucket_tag":
+			category = pindb.UnrelatedPinDBBucketTagWarning
+		default:
+			return fmt.Errorf("unknown warning: %s", cCtx.String("warning"))
+		}
+
+		var tag *pindb.Tag
+		if strings.TrimSpace(cCtx.String("tag")) != "" {
+			t := pindb.NewTag(cCtx.String("tag"))
+			tag = &t
+		}
+
+		w := pindb.NewWarning(category, tag)
+		warning = &w
+	}
+
+	fixed := []*pindb.Link{}
+	perrs := []error{}
+	for _, l := range links {
+		warnings := l.Warnings()
+		if warning != nil {
+			warnings = pindb.Warnings{}
+			for _, w := range l.Warnings() {
+				if w.Category() == warning.Category() {
+					warnings = pindb.Warnings{*warning}
+					break
+				}
+			}
+		}
+
+		if len(warnings) == 0 {
+			continue
+		}
+
+		l, perr := l.FixContext(cCtx.Context, warnings...)
+		if !applied(perr) {
+			return perr
+		}
+		if perr != nil {
+			perrs = append(perrs, perr)
+		}
+
+		fixed = append(fixed, l)
+	}
+
 	if strings.TrimSpace(passphrase) == "" {
-		err = store.Write(path)
+		err = writePath(store, path)
 	} else {
-		err = store.WriteEncrypted(path, passphrase)
+		err = writeEncryptedPath(store, path, passphrase)
 	}
 
 	if err != nil {
 		return err
 	}
 
+	fmt.Fprintf(statusOutput(path), "fixed %d link(s)\n", len(fixed))
+	printPending(statusOutput(path), store)
+
 	if cCtx.Bool("print") {
-		printLink(l)
+		printLinks(statusOutput(path), fixed)
 	}
 
-	return nil
+	return errors.Join(perrs...)
 }
 
 func listJsonLinks(cCtx *cli.Context) error {
-	pdb := pindb.New()
+	pdb := newClient(cCtx)
 	path := cCtx.String("path")
 	passphrase := cCtx.String("passphrase")
 
 	var store *pindb.Store
 	var err error
 	if strings.TrimSpace(passphrase) == "" {
-		store, err = pdb.Read(path)
+		store, err = readPath(pdb, path)
 	} else {
-		store, err = pdb.ReadEncrypted(path, passphrase)
+		store, err = readEncryptedPath(pdb, path, passphrase)
 	}
 
 	if err != nil {
@@ -437,16 +792,16 @@ func listJsonLinks(cCtx *cli.Context) error {
 }
 
 func jsonLink(cCtx *cli.Context) error {
-	pdb := pindb.New()
+	pdb := newClient(cCtx)
 	path := cCtx.String("path")
 	passphrase := cCtx.String("passphrase")
 
 	var store *pindb.Store
 	var err error
 	if strings.TrimSpace(passphrase) == "" {
-		store, err = pdb.Read(path)
+		store, err = readPath(pdb, path)
 	} else {
-		store, err = pdb.ReadEncrypted(path, passphrase)
+		store, err = readEncryptedPath(pdb, path, passphrase)
 	}
 
 	if err != nil {
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/tmstn/pindb"
+	"github.com/urfave/cli/v2"
+)
+
+// locked runs a command that writes the store at --path while holding its
+// lock file. Commands that only read it take no lock, so they work on files
+// in read-only directories.
+func locked(action cli.ActionFunc) cli.ActionFunc {
+	return func(cCtx *cli.Context) error {
+		path := cCtx.String("path")
+		if strings.TrimSpace(path) == "" || path == "-" {
+			return action(cCtx)
+		}
+
+		l, err := pindb.LockFile(path, cCtx.Duration("lock-timeout"))
+		if err != nil {
+			return err
+		}
+
+		err = action(cCtx)
+		return errors.Join(err, l.Unlock())
+	}
+}
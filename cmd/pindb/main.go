@@ -1,13 +1,37 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/urfave/cli/v2"
 )
 
 func main() {
+	// the first interrupt cancels the calls to pinboard so the command can
+	// stop without writing a half updated store, a second one kills pindb
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
 	app := createApp()
-	if err := app.Run(os.Args); err != nil {
-		fmt.Printf("\n%s", err.Error())
+	if err := app.RunContext(ctx, os.Args); err != nil {
+		fmt.Fprintf(os.Stderr, "\n%s", err.Error())
+
+		var exit cli.ExitCoder
+		if errors.As(err, &exit) {
+			os.Exit(exit.ExitCode())
+		}
+
+		if errors.Is(err, context.Canceled) {
+			os.Exit(130)
+		}
+		os.Exit(1)
 	}
 }
@@ -1,72 +1,359 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/tmstn/pindb"
 )
 
-func printStore(s *pindb.Store, incBuckets, incLinks bool) {
-	fmt.Println("========STORE:========")
-	fmt.Printf("Name: %s\n", s.Name())
-	fmt.Printf("UUID: %s\n", s.UUID())
+func printStore(w io.Writer, s *pindb.Store, incBuckets, incLinks bool) {
+	fmt.Fprintln(w, "========STORE:========")
+	fmt.Fprintf(w, "Name: %s\n", s.Name())
+	fmt.Fprintf(w, "UUID: %s\n", s.UUID())
 	t := "Not Refreshed"
 	if s.RefreshedAt() != nil {
 		t = s.RefreshedAt().Format(time.RFC3339)
 	}
-	fmt.Printf("Refreshed At: %s\n", t)
-	fmt.Printf("Tag: %s\n", s.Tag())
+	fmt.Fprintf(w, "Refreshed At: %s\n", t)
+	fmt.Fprintf(w, "Tag: %s\n", s.Tag())
+	fmt.Fprintf(w, "Manifest: %t\n", s.Manifest())
+	fmt.Fprintf(w, "Format: v%d\n", s.Version())
 
 	if incBuckets {
-		printBuckets(s.Buckets(), incLinks)
+		printBuckets(w, s.Buckets(), incLinks)
 	}
 }
 
-func printBuckets(b []*pindb.Bucket, incLinks bool) {
+func printBuckets(w io.Writer, b []*pindb.Bucket, incLinks bool) {
 	for _, i := range b {
-		printBucket(i, incLinks)
+		printBucket(w, i, incLinks)
 	}
 }
 
-func printBucket(b *pindb.Bucket, incLinks bool) {
-	fmt.Println("--------BUCKET:-------")
-	fmt.Printf("Name: %s\n", b.Name())
-	fmt.Printf("UUID: %s\n", b.UUID())
+func printBucket(w io.Writer, b *pindb.Bucket, incLinks bool) {
+	fmt.Fprintln(w, "--------BUCKET:-------")
+	fmt.Fprintf(w, "Name: %s\n", b.Name())
+	fmt.Fprintf(w, "UUID: %s\n", b.UUID())
 	t := "Not Refreshed"
 	if b.RefreshedAt() != nil {
 		t = b.RefreshedAt().Format(time.RFC3339)
 	}
-	fmt.Printf("Refreshed At: %s\n", t)
-	fmt.Printf("Tag: %s\n", b.Tag())
+	fmt.Fprintf(w, "Refreshed At: %s\n", t)
+	fmt.Fprintf(w, "Tag: %s\n", b.Tag())
 
 	if incLinks {
-		printLinks(b.Links())
+		printLinks(w, b.Links())
 	}
 }
 
-func printLinks(l []*pindb.Link) {
+func printLinks(w io.Writer, l []*pindb.Link) {
 	for _, i := range l {
-		printLink(i)
+		printLink(w, i)
 	}
 }
 
-func printLink(l *pindb.Link) {
-	fmt.Println("++++++++LINK:++++++++")
-	fmt.Printf("UUID: %s\n", l.UUID())
-	fmt.Printf("Title: %s\n", l.Title())
-	fmt.Printf("URL: %s\n", l.URL(false).String())
-	fmt.Printf("Group: %s\n", l.Group())
-	fmt.Printf("Tags: %s\n", strings.Join(l.Tags(false).Strings(), ", "))
-	printWarnings(l.Warnings())
+func printLink(w io.Writer, l *pindb.Link) {
+	fmt.Fprintln(w, "++++++++LINK:++++++++")
+	fmt.Fprintf(w, "UUID: %s\n", l.UUID())
+	fmt.Fprintf(w, "Title: %s\n", l.Title())
+	fmt.Fprintf(w, "URL: %s\n", l.URL(false).String())
+	if g := l.Group(); g != nil {
+		fmt.Fprintf(w, "Group: %s (%s)\n", g.Name(), g.UUID())
+	} else {
+		fmt.Fprintln(w, "Group: ")
+	}
+	fmt.Fprintf(w, "Tags: %s\n", strings.Join(l.Tags(false).Strings(), ", "))
+	if l.Dirty() {
+		fmt.Fprintln(w, "Pending: changes not yet pushed")
+	}
+	printWarnings(w, l.Warnings())
+}
+
+func printWarnings(w io.Writer, warnings pindb.Warnings) {
+	if len(warnings) > 0 {
+		fmt.Fprintln(w, "......WARNINGS......")
+		for i, m := range warnings {
+			fmt.Fprintf(w, "%d: %s\n", i+1, m.String())
+		}
+	}
+}
+
+func printOperations(w io.Writer, o []*pindb.Operation) {
+	if len(o) == 0 {
+		fmt.Fprintln(w, "Nothing to push")
+		return
+	}
+
+	fmt.Fprintln(w, "........QUEUE.......")
+	for i, op := range o {
+		fmt.Fprintf(w, "%d: %s %s (bucket %s, link %s)\n", i+1, op.Kind(), op.URL(), op.Bucket(), op.Link())
+	}
+}
+
+func printPending(w io.Writer, s *pindb.Store) {
+	n := len(s.Pending())
+	if n > 0 {
+		fmt.Fprintf(w, "%d change(s) not yet pushed to pinboard, run `pindb sync push` to retry\n", n)
+	}
+}
+
+func printRefreshResult(w io.Writer, r *pindb.RefreshResult, format string) error {
+	switch format {
+	case "json":
+		d, err := json.MarshalIndent(r.JSON(), "", " ")
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(w, string(d))
+	case "text":
+		if r.Empty() {
+			fmt.Fprintln(w, "No changes")
+		}
+
+		for _, b := range r.Buckets() {
+			printBucketChanges(w, b)
+		}
+	default:
+		return fmt.Errorf("unknown format: %s", format)
+	}
+
+	return nil
 }
 
-func printWarnings(w pindb.Warnings) {
-	if len(w) > 0 {
-		fmt.Println("......WARNINGS......")
-		for i, m := range w {
-			fmt.Printf("%d: %s\n", i+1, m.String())
+func printRefreshAllResult(w io.Writer, pdb *pindb.Client, r *pindb.RefreshAllResult, format string) error {
+	switch format {
+	case "json":
+		d, err := json.MarshalIndent(r.JSON(), "", " ")
+		if err != nil {
+			return err
 		}
+
+		fmt.Fprintln(w, string(d))
+	case "text":
+		failed := r.Errors()
+		for _, s := range pdb.Stores() {
+			res, _ := r.Result(s.UUID())
+			if res == nil {
+				continue
+			}
+
+			fmt.Fprintln(w, "========STORE:========")
+			fmt.Fprintf(w, "Name: %s\n", s.Name())
+			fmt.Fprintf(w, "UUID: %s\n", s.UUID())
+			if err, ok := failed[s.UUID()]; ok {
+				fmt.Fprintf(w, "Error: %s\n", err)
+			} else if res.Empty() {
+				fmt.Fprintln(w, "No changes")
+			}
+
+			for _, b := range res.Buckets() {
+				printBucketChanges(w, b)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown format: %s", format)
 	}
+
+	return nil
+}
+
+func printStoreDiff(w io.Writer, d *pindb.StoreDiff, format string) error {
+	switch format {
+	case "json":
+		j, err := json.MarshalIndent(d.JSON(), "", " ")
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(w, string(j))
+	case "text":
+		if d.Empty() {
+			fmt.Fprintln(w, "No changes")
+		}
+
+		if d.Before().Name() != d.After().Name() {
+			fmt.Fprintf(w, "Store Name: %s -> %s\n", d.Before().Name(), d.After().Name())
+		}
+		for _, b := range d.Added() {
+			fmt.Fprintf(w, "+ bucket %s %s (%d links)\n", b.UUID(), b.Name(), len(b.Links()))
+		}
+		for _, b := range d.Removed() {
+			fmt.Fprintf(w, "- bucket %s %s (%d links)\n", b.UUID(), b.Name(), len(b.Links()))
+		}
+		for _, b := range d.Buckets() {
+			printBucketChanges(w, b)
+		}
+	default:
+		return fmt.Errorf("unknown format: %s", format)
+	}
+
+	return nil
+}
+
+func printBucketChanges(w io.Writer, c *pindb.BucketChanges) {
+	fmt.Fprintln(w, "--------BUCKET:-------")
+	fmt.Fprintf(w, "Name: %s\n", c.Name())
+	if c.PreviousName() != "" {
+		fmt.Fprintf(w, "Renamed From: %s\n", c.PreviousName())
+	}
+	fmt.Fprintf(w, "UUID: %s\n", c.UUID())
+	for _, l := range c.Added() {
+		fmt.Fprintf(w, "+ %s %s (%s)\n", l.UUID(), l.Title(), l.URL(false).String())
+	}
+	for _, l := range c.Removed() {
+		fmt.Fprintf(w, "- %s %s (%s)\n", l.UUID(), l.Title(), l.URL(false).String())
+	}
+	for _, l := range c.Changed() {
+		fields := []string{}
+		for _, f := range l.Fields() {
+			fields = append(fields, f.String())
+		}
+		fmt.Fprintf(w, "~ %s %s [%s]\n", l.After().UUID(), l.After().Title(), strings.Join(fields, ", "))
+		for _, f := range l.Fields() {
+			switch f {
+			case pindb.TitleField:
+				fmt.Fprintf(w, "    title: %s -> %s\n", l.Before().Title(), l.After().Title())
+			case pindb.URLField:
+				fmt.Fprintf(w, "    url: %s -> %s\n", l.Before().URL(false).String(), l.After().URL(false).String())
+			case pindb.GroupField:
+				fmt.Fprintf(w, "    group: %s -> %s\n", groupName(l.Before().Group()), groupName(l.After().Group()))
+			case pindb.TagsField:
+				fmt.Fprintf(w, "    tags: %s -> %s\n", strings.Join(l.Before().Tags(false).Strings(), ", "), strings.Join(l.After().Tags(false).Strings(), ", "))
+			}
+		}
+	}
+}
+
+func printRecoverReport(w io.Writer, r *pindb.RecoverReport, format string) error {
+	switch format {
+	case "json":
+		d, err := json.MarshalIndent(r.JSON(), "", " ")
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(w, string(d))
+	case "text":
+		fmt.Fprintf(w, "Posts: %d\n", r.Posts())
+		fmt.Fprintf(w, "Buckets: %d\n", r.Buckets())
+		fmt.Fprintf(w, "Links: %d\n", r.Links())
+		if len(r.Corrupt()) > 0 {
+			fmt.Fprintln(w, "......CORRUPT.......")
+			for i, c := range r.Corrupt() {
+				fmt.Fprintf(w, "%d: %s (%s): %s\n", i+1, c.Title(), c.URL(), c.Reason())
+			}
+		}
+	default:
+		return fmt.Errorf("unknown format: %s", format)
+	}
+
+	return nil
+}
+
+func printDiagnosis(w io.Writer, d *pindb.Diagnosis, format string) error {
+	switch format {
+	case "json":
+		j, err := json.MarshalIndent(d.JSON(), "", " ")
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(w, string(j))
+	case "text":
+		fmt.Fprintf(w, "Links: %d\n", d.Links())
+		if !d.Remote() {
+			fmt.Fprintln(w, "Pinboard: not checked")
+		}
+
+		categories := []pindb.WarningCategory{}
+		for k := range d.Warnings() {
+			categories = append(categories, k)
+		}
+		sort.Slice(categories, func(i, j int) bool {
+			return categories[i] < categories[j]
+		})
+
+		if len(categories) > 0 {
+			fmt.Fprintln(w, "......WARNINGS......")
+		}
+		for _, k := range categories {
+			fmt.Fprintf(w, "%s: %d link(s)\n", k, len(d.Warnings()[k]))
+			for _, l := range d.Warnings()[k] {
+				fmt.Fprintf(w, "  %s %s\n", l.UUID(), l.Title())
+			}
+		}
+
+		if len(d.Problems()) > 0 {
+			fmt.Fprintln(w, "......PROBLEMS......")
+		}
+		for _, p := range d.Problems() {
+			fmt.Fprintf(w, "%s: %s: %s\n", p.Kind(), p.Subject(), p.Detail())
+		}
+
+		if d.Healthy() {
+			fmt.Fprintln(w, "No problems found")
+		}
+	default:
+		return fmt.Errorf("unknown format: %s", format)
+	}
+
+	return nil
+}
+
+func printSnapshot(w io.Writer, s *pindb.Snapshot, store *pindb.Store, err error) {
+	if err != nil {
+		fmt.Fprintf(w, "%s  %s  unreadable: %s\n", s.Name(), s.TakenAt().Local().Format(time.RFC3339), err.Error())
+		return
+	}
+
+	links := 0
+	for _, b := range store.Buckets() {
+		links += len(b.Links())
+	}
+	fmt.Fprintf(w, "%s  %s  %d bucket(s)  %d link(s)\n", s.Name(), s.TakenAt().Local().Format(time.RFC3339), len(store.Buckets()), links)
+}
+
+func printTags(w io.Writer, t map[pindb.Tag]int) {
+	tags := []pindb.Tag{}
+	for k := range t {
+		tags = append(tags, k)
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if t[tags[i]] != t[tags[j]] {
+			return t[tags[i]] > t[tags[j]]
+		}
+		return tags[i] < tags[j]
+	})
+
+	for _, k := range tags {
+		fmt.Fprintf(w, "%s: %d\n", k, t[k])
+	}
+}
+
+func groupName(g *pindb.Group) string {
+	if g == nil {
+		return "none"
+	}
+	return g.Name()
+}
+
+func printGroups(w io.Writer, g []*pindb.Group) {
+	for _, i := range g {
+		printGroup(w, i)
+	}
+}
+
+func printGroup(w io.Writer, g *pindb.Group) {
+	fmt.Fprintln(w, "~~~~~~~~GROUP:~~~~~~~")
+	fmt.Fprintf(w, "Name: %s\n", g.Name())
+	fmt.Fprintf(w, "UUID: %s\n", g.UUID())
+	fmt.Fprintf(w, "Order: %d\n", g.Order())
+	fmt.Fprintf(w, "Links: %d\n", len(g.Links()))
+	fmt.Fprintf(w, "Tag: %s\n", g.Tag())
 }
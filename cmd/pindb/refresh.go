@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/tmstn/pindb"
+	"github.com/urfave/cli/v2"
+)
+
+func refreshAll(cCtx *cli.Context) error {
+	pdb := newClient(cCtx)
+	passphrase := cCtx.String("passphrase")
+
+	if !cCtx.Bool("all") && len(cCtx.StringSlice("bucket")) == 0 {
+		return errors.New("either --all or --bucket is required")
+	}
+
+	paths := []string{}
+	if strings.TrimSpace(cCtx.String("path")) != "" {
+		paths = append(paths, cCtx.String("path"))
+	}
+	paths = append(paths, cCtx.Args().Slice()...)
+
+	if len(paths) == 0 {
+		return errors.New("no store to refresh, give --path or store files as arguments")
+	}
+
+	for _, path := range paths {
+		if path == "-" && len(paths) > 1 {
+			return errors.New("- can only be used to refresh a single store")
+		}
+	}
+
+	// the store at --path is already locked by locked
+	for _, path := range cCtx.Args().Slice() {
+		if path == cCtx.String("path") {
+			continue
+		}
+
+		l, err := pindb.LockFile(path, cCtx.Duration("lock-timeout"))
+		if err != nil {
+			return err
+		}
+		defer l.Unlock()
+	}
+
+	files := map[uuid.UUID]string{}
+	for _, path := range paths {
+		var store *pindb.Store
+		var err error
+		if strings.TrimSpace(passphrase) == "" {
+			store, err = readPath(pdb, path)
+		} else {
+			store, err = readEncryptedPath(pdb, path, passphrase)
+		}
+
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		if f, ok := files[store.UUID()]; ok {
+			return fmt.Errorf("%s and %s hold the same store", f, path)
+		}
+		files[store.UUID()] = path
+	}
+
+	opts := &pindb.RefreshOptions{
+		Workers: cCtx.Int("workers"),
+		Force:   cCtx.Bool("force"),
+	}
+
+	for _, b := range cCtx.StringSlice("bucket") {
+		uid, err := uuid.Parse(b)
+		if err != nil {
+			return err
+		}
+		opts.Buckets = append(opts.Buckets, uid)
+	}
+
+	r, rerr := pdb.RefreshAll(cCtx.Context, opts)
+	if r == nil {
+		return rerr
+	}
+
+	failed := r.Errors()
+	for _, store := range pdb.Stores() {
+		if _, ok := failed[store.UUID()]; ok {
+			continue
+		}
+
+		path := files[store.UUID()]
+		var err error
+		if strings.TrimSpace(passphrase) == "" {
+			err = writePath(store, path)
+		} else {
+			err = writeEncryptedPath(store, path, passphrase)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if cCtx.Bool("report") {
+		err := printRefreshAllResult(statusOutput(cCtx.String("path")), pdb, r, cCtx.String("format"))
+		if err != nil {
+			return err
+		}
+	}
+
+	return rerr
+}
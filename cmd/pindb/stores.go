@@ -2,52 +2,54 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
 
+	"github.com/google/uuid"
 	"github.com/tmstn/pindb"
 	"github.com/urfave/cli/v2"
 )
 
 func readStore(cCtx *cli.Context) error {
-	pdb := pindb.New()
+	pdb := newClient(cCtx)
 	path := cCtx.String("path")
 	passphrase := cCtx.String("passphrase")
 
 	var store *pindb.Store
 	var err error
 	if strings.TrimSpace(passphrase) == "" {
-		store, err = pdb.Read(path)
+		store, err = readPath(pdb, path)
 	} else {
-		store, err = pdb.ReadEncrypted(path, passphrase)
+		store, err = readEncryptedPath(pdb, path, passphrase)
 	}
 
 	if err != nil {
 		return err
 	}
 
-	printStore(store, cCtx.Bool("include-buckets"), cCtx.Bool("include-links"))
+	printStore(os.Stdout, store, cCtx.Bool("include-buckets"), cCtx.Bool("include-links"))
 
 	return nil
 }
 
 func addStore(cCtx *cli.Context) error {
-	pdb := pindb.New()
+	pdb := newClient(cCtx)
 	path := cCtx.String("path")
 	passphrase := cCtx.String("passphrase")
 	token := cCtx.String("token")
 	name := cCtx.String("name")
 
-	store, err := pdb.Add(token, name)
+	store, err := pdb.AddContext(cCtx.Context, token, name)
 	if err != nil {
 		return err
 	}
 
 	if strings.TrimSpace(passphrase) == "" {
-		err = store.Write(path)
+		err = writePath(store, path)
 	} else {
-		err = store.WriteEncrypted(path, passphrase)
+		err = writeEncryptedPath(store, path, passphrase)
 	}
 
 	if err != nil {
@@ -55,14 +57,14 @@ func addStore(cCtx *cli.Context) error {
 	}
 
 	if cCtx.Bool("print") {
-		printStore(store, false, false)
+		printStore(statusOutput(path), store, false, false)
 	}
 
 	return nil
 }
 
 func renameStore(cCtx *cli.Context) error {
-	pdb := pindb.New()
+	pdb := newClient(cCtx)
 	path := cCtx.String("path")
 	passphrase := cCtx.String("passphrase")
 	name := cCtx.String("name")
@@ -70,9 +72,9 @@ func renameStore(cCtx *cli.Context) error {
 	var store *pindb.Store
 	var err error
 	if strings.TrimSpace(passphrase) == "" {
-		store, err = pdb.Read(path)
+		store, err = readPath(pdb, path)
 	} else {
-		store, err = pdb.ReadEncrypted(path, passphrase)
+		store, err = readEncryptedPath(pdb, path, passphrase)
 	}
 
 	if err != nil {
@@ -81,9 +83,9 @@ func renameStore(cCtx *cli.Context) error {
 
 	store = store.Rename(name)
 	if strings.TrimSpace(passphrase) == "" {
-		err = store.Write(path)
+		err = writePath(store, path)
 	} else {
-		err = store.WriteEncrypted(path, passphrase)
+		err = writeEncryptedPath(store, path, passphrase)
 	}
 
 	if err != nil {
@@ -91,23 +93,23 @@ func renameStore(cCtx *cli.Context) error {
 	}
 
 	if cCtx.Bool("print") {
-		printStore(store, false, false)
+		printStore(statusOutput(path), store, false, false)
 	}
 
 	return nil
 }
 
 func removeStore(cCtx *cli.Context) error {
-	pdb := pindb.New()
+	pdb := newClient(cCtx)
 	path := cCtx.String("path")
 	passphrase := cCtx.String("passphrase")
 
 	var store *pindb.Store
 	var err error
 	if strings.TrimSpace(passphrase) == "" {
-		store, err = pdb.Read(path)
+		store, err = readPath(pdb, path)
 	} else {
-		store, err = pdb.ReadEncrypted(path, passphrase)
+		store, err = readEncryptedPath(pdb, path, passphrase)
 	}
 
 	if err != nil {
@@ -116,11 +118,16 @@ func removeStore(cCtx *cli.Context) error {
 
 	remLinks := cCtx.Bool("remove-links")
 	remTags := cCtx.Bool("remove-tags")
-	_, err = store.Remove(remLinks, remTags)
+	_, err = store.RemoveContext(cCtx.Context, remLinks, remTags)
 	if err != nil {
 		return err
 	}
 
+	// a store read from stdin has no file to remove
+	if path == "-" {
+		return nil
+	}
+
 	err = os.Remove(path)
 	if err != nil {
 		return err
@@ -130,16 +137,16 @@ func removeStore(cCtx *cli.Context) error {
 }
 
 func refreshStore(cCtx *cli.Context) error {
-	pdb := pindb.New()
+	pdb := newClient(cCtx)
 	path := cCtx.String("path")
 	passphrase := cCtx.String("passphrase")
 
 	var store *pindb.Store
 	var err error
 	if strings.TrimSpace(passphrase) == "" {
-		store, err = pdb.Read(path)
+		store, err = readPath(pdb, path)
 	} else {
-		store, err = pdb.ReadEncrypted(path, passphrase)
+		store, err = readEncryptedPath(pdb, path, passphrase)
 	}
 
 	if err != nil {
@@ -147,35 +154,48 @@ func refreshStore(cCtx *cli.Context) error {
 	}
 
 	force := cCtx.Bool("force")
-	store, err = store.Refresh(force)
+	if cCtx.Bool("dry-run") {
+		r, err := store.PreviewContext(cCtx.Context, force)
+		if err != nil {
+			return err
+		}
+
+		return printRefreshResult(os.Stdout, r, cCtx.String("format"))
+	}
+
+	r, err := store.RefreshContext(cCtx.Context, force)
 	if err != nil {
 		return err
 	}
 
 	if strings.TrimSpace(passphrase) == "" {
-		err = store.Write(path)
+		err = writePath(store, path)
 	} else {
-		err = store.WriteEncrypted(path, passphrase)
+		err = writeEncryptedPath(store, path, passphrase)
 	}
 
 	if err != nil {
 		return err
 	}
 
+	if cCtx.Bool("report") {
+		return printRefreshResult(statusOutput(path), r, cCtx.String("format"))
+	}
+
 	return nil
 }
 
 func jsonStore(cCtx *cli.Context) error {
-	pdb := pindb.New()
+	pdb := newClient(cCtx)
 	path := cCtx.String("path")
 	passphrase := cCtx.String("passphrase")
 
 	var store *pindb.Store
 	var err error
 	if strings.TrimSpace(passphrase) == "" {
-		store, err = pdb.Read(path)
+		store, err = readPath(pdb, path)
 	} else {
-		store, err = pdb.ReadEncrypted(path, passphrase)
+		store, err = readEncryptedPath(pdb, path, passphrase)
 	}
 
 	if err != nil {
@@ -200,3 +220,315 @@ func jsonStore(cCtx *cli.Context) error {
 
 	return nil
 }
+
+func rekeyStore(cCtx *cli.Context) error {
+	pdb := newClient(cCtx)
+	path := cCtx.String("path")
+	passphrase := cCtx.String("passphrase")
+	newPassphrase := cCtx.String("new-passphrase")
+
+	if strings.TrimSpace(newPassphrase) == "" {
+		newPassphrase = passphrase
+	}
+
+	if strings.TrimSpace(newPassphrase) == "" {
+		return errors.New("a passphrase or new passphrase is required")
+	}
+
+	var store *pindb.Store
+	var err error
+	if strings.TrimSpace(passphrase) == "" {
+		store, err = readPath(pdb, path)
+	} else {
+		store, err = readEncryptedPath(pdb, path, passphrase)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	err = writeEncryptedPath(store, path, newPassphrase)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func recoverStore(cCtx *cli.Context) error {
+	pdb := newClient(cCtx)
+	path := cCtx.String("path")
+	passphrase := cCtx.String("passphrase")
+	token := cCtx.String("token")
+
+	_, err := os.Stat(path)
+	if err == nil {
+		return fmt.Errorf("%s already exists", path)
+	}
+
+	id, err := uuid.Parse(cCtx.String("store-uuid"))
+	if err != nil {
+		return err
+	}
+
+	store, report, err := pdb.RecoverContext(cCtx.Context, token, id)
+	if err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(cCtx.String("name")) != "" {
+		store = store.Rename(cCtx.String("name"))
+	}
+
+	if strings.TrimSpace(passphrase) == "" {
+		err = writePath(store, path)
+	} else {
+		err = writeEncryptedPath(store, path, passphrase)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return printRecoverReport(statusOutput(path), report, cCtx.String("format"))
+}
+
+func manifestStore(cCtx *cli.Context) error {
+	pdb := newClient(cCtx)
+	path := cCtx.String("path")
+	passphrase := cCtx.String("passphrase")
+
+	var store *pindb.Store
+	var err error
+	if strings.TrimSpace(passphrase) == "" {
+		store, err = readPath(pdb, path)
+	} else {
+		store, err = readEncryptedPath(pdb, path, passphrase)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	enable := cCtx.Bool("enable")
+	disable := cCtx.Bool("disable")
+	if enable && disable {
+		return errors.New("only one of enable or disable can be set")
+	}
+
+	if !enable && !disable {
+		fmt.Printf("Manifest: %t\n", store.Manifest())
+		return nil
+	}
+
+	store, err = store.SetManifestContext(cCtx.Context, enable)
+	if err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(passphrase) == "" {
+		err = writePath(store, path)
+	} else {
+		err = writeEncryptedPath(store, path, passphrase)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func doctorStore(cCtx *cli.Context) error {
+	pdb := newClient(cCtx)
+	path := cCtx.String("path")
+	passphrase := cCtx.String("passphrase")
+
+	var store *pindb.Store
+	var err error
+	if strings.TrimSpace(passphrase) == "" {
+		store, err = readPath(pdb, path)
+	} else {
+		store, err = readEncryptedPath(pdb, path, passphrase)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	d := store.DoctorContext(cCtx.Context, path)
+	err = printDiagnosis(os.Stdout, d, cCtx.String("format"))
+	if err != nil {
+		return err
+	}
+
+	if !d.Healthy() {
+		return cli.Exit("problems found", 1)
+	}
+
+	return nil
+}
+
+func diffStores(cCtx *cli.Context) error {
+	passphrase := cCtx.String("passphrase")
+	if cCtx.NArg() != 2 {
+		return errors.New("diff needs two store files")
+	}
+
+	stores := []*pindb.Store{}
+	for _, path := range cCtx.Args().Slice() {
+		pdb := newClient(cCtx)
+
+		var store *pindb.Store
+		var err error
+		if strings.TrimSpace(passphrase) == "" {
+			store, err = readPath(pdb, path)
+		} else {
+			store, err = readEncryptedPath(pdb, path, passphrase)
+		}
+
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		stores = append(stores, store)
+	}
+
+	return printStoreDiff(os.Stdout, pindb.Diff(stores[0], stores[1]), cCtx.String("format"))
+}
+
+func migrateStore(cCtx *cli.Context) error {
+	pdb := newClient(cCtx)
+	path := cCtx.String("path")
+	passphrase := cCtx.String("passphrase")
+
+	var store *pindb.Store
+	var err error
+	if strings.TrimSpace(passphrase) == "" {
+		store, err = readPath(pdb, path)
+	} else {
+		store, err = readEncryptedPath(pdb, path, passphrase)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	from := store.Version()
+	if from > pindb.FormatVersion {
+		return pindb.ErrNewerFormat
+	}
+
+	if from == pindb.FormatVersion {
+		fmt.Fprintf(statusOutput(path), "store is already at format v%d\n", from)
+		return nil
+	}
+
+	if strings.TrimSpace(passphrase) == "" {
+		err = writePath(store, path)
+	} else {
+		err = writeEncryptedPath(store, path, passphrase)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(statusOutput(path), "migrated store from format v%d to v%d\n", from, pindb.FormatVersion)
+
+	return nil
+}
+
+func importStore(cCtx *cli.Context) error {
+	pdb := newClient(cCtx)
+	path := cCtx.String("path")
+	passphrase := cCtx.String("passphrase")
+
+	if cCtx.String("format") != "json" {
+		return fmt.Errorf("unsupported import format: %s", cCtx.String("format"))
+	}
+
+	if cCtx.NArg() > 1 {
+		return errors.New("import takes at most one file")
+	}
+
+	if path != "-" && !cCtx.Bool("overwrite") {
+		_, err := os.Stat(path)
+		if err == nil {
+			return fmt.Errorf("%s already exists", path)
+		}
+	}
+
+	in := os.Stdin
+	if cCtx.NArg() == 1 && cCtx.Args().First() != "-" {
+		f, err := os.Open(cCtx.Args().First())
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	store, err := pdb.ReadJSON(in)
+	if err != nil {
+		return fmt.Errorf("invalid store export: %w", err)
+	}
+
+	if strings.TrimSpace(passphrase) == "" {
+		err = writePath(store, path)
+	} else {
+		err = writeEncryptedPath(store, path, passphrase)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(statusOutput(path), "imported store %s (%s) with %d bucket(s)\n", store.Name(), store.UUID(), len(store.Buckets()))
+
+	return nil
+}
+
+func historyStore(cCtx *cli.Context) error {
+	path := cCtx.String("path")
+	passphrase := cCtx.String("passphrase")
+
+	snapshots, err := pindb.History(path)
+	if err != nil {
+		return err
+	}
+
+	if len(snapshots) == 0 {
+		fmt.Println("No snapshots")
+	}
+
+	for _, s := range snapshots {
+		pdb := newClient(cCtx)
+
+		var store *pindb.Store
+		var err error
+		if strings.TrimSpace(passphrase) == "" {
+			store, err = pdb.Read(s.Path())
+		} else {
+			store, err = pdb.ReadEncrypted(s.Path(), passphrase)
+		}
+
+		printSnapshot(os.Stdout, s, store, err)
+	}
+
+	return nil
+}
+
+func rollbackStore(cCtx *cli.Context) error {
+	pdb := newClient(cCtx)
+	path := cCtx.String("path")
+
+	err := pdb.Rollback(path, cCtx.String("to"))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("restored %s to %s\n", path, cCtx.String("to"))
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/tmstn/pindb"
+	"github.com/urfave/cli/v2"
+)
+
+func pushSync(cCtx *cli.Context) error {
+	pdb := newClient(cCtx)
+	path := cCtx.String("path")
+	passphrase := cCtx.String("passphrase")
+
+	var store *pindb.Store
+	var err error
+	if strings.TrimSpace(passphrase) == "" {
+		store, err = readPath(pdb, path)
+	} else {
+		store, err = readEncryptedPath(pdb, path, passphrase)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	store, perr := store.PushContext(cCtx.Context)
+
+	if strings.TrimSpace(passphrase) == "" {
+		err = writePath(store, path)
+	} else {
+		err = writeEncryptedPath(store, path, passphrase)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if perr != nil {
+		return perr
+	}
+
+	printPending(statusOutput(path), store)
+
+	return nil
+}
+
+func statusSync(cCtx *cli.Context) error {
+	pdb := newClient(cCtx)
+	path := cCtx.String("path")
+	passphrase := cCtx.String("passphrase")
+
+	var store *pindb.Store
+	var err error
+	if strings.TrimSpace(passphrase) == "" {
+		store, err = readPath(pdb, path)
+	} else {
+		store, err = readEncryptedPath(pdb, path, passphrase)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if cCtx.Bool("json") {
+		d, err := json.MarshalIndent(store.JSON().Pending, "", " ")
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(string(d))
+		return nil
+	}
+
+	printOperations(os.Stdout, store.Pending())
+
+	return nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/tmstn/pindb"
+	"github.com/urfave/cli/v2"
+)
+
+func listTags(cCtx *cli.Context) error {
+	pdb := newClient(cCtx)
+	path := cCtx.String("path")
+	passphrase := cCtx.String("passphrase")
+
+	var store *pindb.Store
+	var err error
+	if strings.TrimSpace(passphrase) == "" {
+		store, err = readPath(pdb, path)
+	} else {
+		store, err = readEncryptedPath(pdb, path, passphrase)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(cCtx.String("bucket")) == "" {
+		printTags(os.Stdout, store.Tags())
+		return nil
+	}
+
+	bid, err := uuid.Parse(cCtx.String("bucket"))
+	if err != nil {
+		return err
+	}
+
+	b, err := store.Bucket(bid)
+	if err != nil {
+		return err
+	}
+
+	printTags(os.Stdout, b.Tags())
+
+	return nil
+}
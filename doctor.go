@@ -0,0 +1,267 @@
+package pindb
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/tmstn/pinboard"
+)
+
+type ProblemKind string
+
+func (k ProblemKind) String() string {
+	return string(k)
+}
+
+const (
+	InvalidTokenProblem  ProblemKind = "invalid_token"
+	PinboardProblem      ProblemKind = "pinboard_error"
+	OrphanedTagProblem   ProblemKind = "orphaned_tag"
+	UntrackedPostProblem ProblemKind = "untracked_post"
+	WorldReadableProblem ProblemKind = "world_readable"
+)
+
+// Problem is something wrong with a store beyond the warnings of its links.
+type Problem struct {
+	kind    ProblemKind
+	subject string
+	detail  string
+}
+
+func (p *Problem) Kind() ProblemKind {
+	return p.kind
+}
+
+// Subject is the tag, url or path the problem was found on.
+func (p *Problem) Subject() string {
+	return p.subject
+}
+
+func (p *Problem) Detail() string {
+	return p.detail
+}
+
+func (p *Problem) JSON() ProblemJSON {
+	j := ProblemJSON{}
+	j.Kind = p.kind.String()
+	j.Subject = p.subject
+	j.Detail = p.detail
+	return j
+}
+
+type Diagnosis struct {
+	links    int
+	warnings map[WarningCategory][]*Link
+	problems []*Problem
+	remote   bool
+}
+
+// Links is the number of links that were checked.
+func (d *Diagnosis) Links() int {
+	return d.links
+}
+
+// Warnings groups the links that have warnings by category.
+func (d *Diagnosis) Warnings() map[WarningCategory][]*Link {
+	return d.warnings
+}
+
+func (d *Diagnosis) Problems() []*Problem {
+	return d.problems
+}
+
+// Remote reports whether the store was checked against Pinboard.
+func (d *Diagnosis) Remote() bool {
+	return d.remote
+}
+
+func (d *Diagnosis) Healthy() bool {
+	return len(d.warnings) == 0 && len(d.problems) == 0
+}
+
+func (d *Diagnosis) problem(kind ProblemKind, subject, detail string) {
+	d.problems = append(d.problems, &Problem{
+		kind:    kind,
+		subject: subject,
+		detail:  detail,
+	})
+}
+
+func (d *Diagnosis) JSON() DiagnosisJSON {
+	j := DiagnosisJSON{}
+	j.Links = d.links
+	j.Remote = d.remote
+	j.Healthy = d.Healthy()
+	j.Warnings = map[string][]string{}
+	for k, v := range d.warnings {
+		for _, l := range v {
+			j.Warnings[k.String()] = append(j.Warnings[k.String()], l.uuid.String())
+		}
+	}
+	j.Problems = []ProblemJSON{}
+	for _, p := range d.problems {
+		j.Problems = append(j.Problems, p.JSON())
+	}
+	return j
+}
+
+// Doctor checks every link of the store for warnings and, unless offline,
+// checks Pinboard for tags and posts the store does not account for. When
+// path is set the store file is checked too.
+func (s *Store) Doctor(path string) *Diagnosis {
+	return s.DoctorContext(context.Background(), path)
+}
+
+func (s *Store) DoctorContext(ctx context.Context, path string) *Diagnosis {
+	d := s.diagnoseLinks(path)
+	if s.client != nil && s.client.offline {
+		return d
+	}
+
+	s.remote.Lock()
+	defer s.remote.Unlock()
+
+	api, err := s.api(ctx)
+	if err != nil {
+		// only a token Pinboard refuses is invalid, not one it could not
+		// be asked about
+		switch status(err) {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			d.problem(InvalidTokenProblem, s.user.username, err.Error())
+		default:
+			d.problem(PinboardProblem, "user/secret", err.Error())
+		}
+		return d
+	}
+	d.remote = true
+
+	s.diagnoseTags(ctx, d, api)
+	s.diagnosePosts(ctx, d, api)
+	return d
+}
+
+func (s *Store) diagnoseLinks(path string) *Diagnosis {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := &Diagnosis{
+		warnings: map[WarningCategory][]*Link{},
+		problems: []*Problem{},
+	}
+
+	for _, b := range s.buckets.list() {
+		for _, l := range b.links.list() {
+			d.links++
+			l.validate()
+			seen := map[WarningCategory]bool{}
+			for _, w := range l.warnings {
+				if !seen[w.category] {
+					d.warnings[w.category] = append(d.warnings[w.category], l)
+					seen[w.category] = true
+				}
+			}
+		}
+	}
+
+	for _, v := range d.warnings {
+		sort.Slice(v, func(i, j int) bool {
+			return lessLink(v[i], v[j])
+		})
+	}
+
+	if path != "" {
+		info, err := os.Stat(path)
+		if err == nil && info.Mode().Perm()&0o004 != 0 {
+			d.problem(WorldReadableProblem, path, fmt.Sprintf("file mode is %s", info.Mode().Perm()))
+		}
+	}
+	return d
+}
+
+func (s *Store) diagnoseTags(ctx context.Context, d *Diagnosis, api Backend) {
+	tags, err := api.Tags(ctx)
+	if err != nil {
+		d.problem(PinboardProblem, "tags/get", err.Error())
+		return
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rgb := regexp.MustCompile(fmt.Sprintf(`^/pindb/store:\"%s\"/bucket:\"([0-9a-f\-]+)\"$`, s.uuid.String()))
+	rgg := regexp.MustCompile(`^/pindb/bucket:\"([0-9a-f\-]+)\"/group:\"([0-9a-f\-]+)\"$`)
+
+	names := []string{}
+	for t := range tags {
+		names = append(names, t)
+	}
+	sort.Strings(names)
+
+	for _, t := range names {
+		if rgb.MatchString(t) {
+			uid, err := uuid.Parse(rgb.FindStringSubmatch(t)[1])
+			if err != nil || !s.buckets.has(uid) {
+				d.problem(OrphanedTagProblem, t, fmt.Sprintf("no bucket in the store, used by %d post(s)", tags[t]))
+			}
+		} else if rgg.MatchString(t) {
+			m := rgg.FindStringSubmatch(t)
+			buid, err := uuid.Parse(m[1])
+			if err != nil {
+				continue
+			}
+
+			b, err := s.buckets.get(buid)
+			if err != nil {
+				// the bucket may belong to another store
+				continue
+			}
+
+			guid, err := uuid.Parse(m[2])
+			if err != nil || !b.groups.has(guid) {
+				d.problem(OrphanedTagProblem, t, fmt.Sprintf("no group in bucket %s, used by %d post(s)", b.name, tags[t]))
+			}
+		}
+	}
+}
+
+func (s *Store) diagnosePosts(ctx context.Context, d *Diagnosis, api Backend) {
+	posts, err := api.All(ctx, &pinboard.PostsAllOptions{
+		Tag: []string{s.Tag().String()},
+	})
+	if err != nil {
+		d.problem(PinboardProblem, "posts/all", err.Error())
+		return
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, post := range posts {
+		if s.isManifest(post) {
+			continue
+		}
+
+		if len(s.bucketsForPost(post)) == 0 {
+			d.problem(UntrackedPostProblem, post.Href.String(), "tagged for the store but not for any bucket in it")
+		}
+	}
+}
+
+type DiagnosisJSON struct {
+	Links    int                 `json:"links"`
+	Remote   bool                `json:"remote"`
+	Healthy  bool                `json:"healthy"`
+	Warnings map[string][]string `json:"warnings"`
+	Problems []ProblemJSON       `json:"problems"`
+}
+
+type ProblemJSON struct {
+	Kind    string `json:"kind,omitempty"`
+	Subject string `json:"subject,omitempty"`
+	Detail  string `json:"detail,omitempty"`
+}
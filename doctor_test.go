@@ -0,0 +1,42 @@
+package pindb
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// refusingBackend fails to authenticate with err.
+type refusingBackend struct {
+	*MemoryBackend
+	err error
+}
+
+func (r *refusingBackend) Authenticate(ctx context.Context) error {
+	return r.err
+}
+
+func TestDoctorReportsInvalidTokensOnlyWhenRefused(t *testing.T) {
+	for _, c := range []struct {
+		err  error
+		want ProblemKind
+	}{
+		{errors.New("error: http 401"), InvalidTokenProblem},
+		{errors.New("error: http 403"), InvalidTokenProblem},
+		{errors.New("connection refused"), PinboardProblem},
+	} {
+		m := &refusingBackend{MemoryBackend: NewMemoryBackend()}
+		s, _ := newTestStore(t, m)
+
+		m.err = c.err
+		s.user.authenticated = false
+
+		d := s.Doctor("")
+		if p := d.Problems(); len(p) != 1 || p[0].Kind() != c.want {
+			t.Errorf("got %v for %q, want %s", p, c.err, c.want)
+		}
+		if d.Remote() {
+			t.Errorf("got a remote check for %q", c.err)
+		}
+	}
+}
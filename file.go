@@ -0,0 +1,137 @@
+package pindb
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const lockRetry = 100 * time.Millisecond
+
+var ErrLocked = errors.New("store file is locked by another process")
+
+func openFile(path string) (*os.File, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return nil, fmt.Errorf("%s is not a file", path)
+	}
+
+	return os.Open(path)
+}
+
+// writeFile replaces path with data so that a crash leaves either the old or
+// the new file, never a truncated one. The file is readable by its owner
+// only since it holds the Pinboard token. When history is above zero the
+// old file is kept as a snapshot first.
+func writeFile(path string, history int, write func(w io.Writer) error) error {
+	info, err := os.Stat(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if err == nil && info.IsDir() {
+		return fmt.Errorf("%s is not a file", path)
+	}
+
+	if err == nil && history > 0 {
+		err = snapshot(path, history)
+		if err != nil {
+			return err
+		}
+	}
+
+	dir, name := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+
+	f, err := os.CreateTemp(dir, "."+name+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+
+	err = f.Chmod(0600)
+	if err == nil {
+		err = write(f)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	// make the rename durable, not every platform can sync a directory
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+
+	return nil
+}
+
+func writeBytes(data []byte) func(w io.Writer) error {
+	return func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	}
+}
+
+// Lock is an advisory lock on a store file, held by creating a lock file
+// next to it. It only keeps out other processes that take the lock too.
+type Lock struct {
+	path string
+}
+
+// LockFile locks the store file at path, waiting up to timeout for another
+// process to release it.
+func LockFile(path string, timeout time.Duration) (*Lock, error) {
+	lp := path + ".lock"
+	deadline := time.Now().Add(timeout)
+	for {
+		f, err := os.OpenFile(lp, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+			return &Lock{path: lp}, nil
+		}
+
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+
+		if !time.Now().Before(deadline) {
+			holder := "another process"
+			if pid, err := os.ReadFile(lp); err == nil && strings.TrimSpace(string(pid)) != "" {
+				holder = "process " + strings.TrimSpace(string(pid))
+			}
+			return nil, fmt.Errorf("%w: %s is held by %s, remove it if that process is no longer running", ErrLocked, lp, holder)
+		}
+
+		time.Sleep(lockRetry)
+	}
+}
+
+func (l *Lock) Path() string {
+	return l.path
+}
+
+func (l *Lock) Unlock() error {
+	return os.Remove(l.path)
+}
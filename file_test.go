@@ -0,0 +1,87 @@
+package pindb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLockFileExcludesOtherLocks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.pindb")
+
+	l, err := LockFile(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = LockFile(path, 0)
+	if !errors.Is(err, ErrLocked) {
+		t.Fatalf("got %v locking a locked file, want ErrLocked", err)
+	}
+	if !strings.Contains(err.Error(), fmt.Sprintf("process %d", os.Getpid())) {
+		t.Errorf("got %q, want the holder named", err)
+	}
+
+	if err := l.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(l.Path()); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("got %v for the lock file after unlock, want it gone", err)
+	}
+
+	l, err = LockFile(path, 0)
+	if err != nil {
+		t.Fatalf("got %v locking an unlocked file", err)
+	}
+	if err := l.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLockFileWaitsForRelease(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.pindb")
+
+	l, err := LockFile(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	released := make(chan error, 1)
+	go func() {
+		time.Sleep(2 * lockRetry)
+		released <- l.Unlock()
+	}()
+
+	w, err := LockFile(path, 5*time.Second)
+	if err != nil {
+		t.Fatalf("got %v waiting for the lock", err)
+	}
+	if err := <-released; err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLockFileGivesUpAfterTimeout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.pindb")
+
+	l, err := LockFile(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Unlock()
+
+	start := time.Now()
+	if _, err := LockFile(path, 3*lockRetry); !errors.Is(err, ErrLocked) {
+		t.Fatalf("got %v, want ErrLocked", err)
+	}
+	if d := time.Since(start); d < 3*lockRetry {
+		t.Errorf("gave up after %s, want the timeout waited", d)
+	}
+}
@@ -0,0 +1,226 @@
+package pindb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	storeHeader = "PINDBSTORE:"
+
+	// FormatVersion is the store file format this client writes.
+	FormatVersion = 3
+)
+
+// ErrNewerFormat is returned when migrating a store file written in a newer
+// format than FormatVersion, which this client cannot migrate it to.
+var ErrNewerFormat = errors.New("store file was written in a newer format, upgrade pindb to migrate it")
+
+// migration rewrites a record of a store file from one format version to
+// the next. Records are migrated one at a time as the file is read.
+type migration func(record string) (string, error)
+
+// migrations is keyed by the version a migration upgrades from.
+var migrations = map[int]migration{
+	// v2 only adds the version to the header, the records are unchanged
+	1: func(record string) (string, error) {
+		return record, nil
+	},
+	// v3 escapes text fields, so escape characters already in them
+	2: func(record string) (string, error) {
+		return strings.ReplaceAll(record, "\u2062", "\u2062e"), nil
+	},
+}
+
+// Text fields in records are escaped so that they can hold the record and
+// tag separators, newlines and the escape character itself, U+2062.
+var escaper = strings.NewReplacer(
+	"\u2062", "\u2062e",
+	"\u2063", "\u2062s",
+	"\u2064", "\u2062p",
+	"\n", "\u2062n",
+)
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+func unescape(s string) string {
+	if !strings.ContainsRune(s, '\u2062') {
+		return s
+	}
+
+	var b strings.Builder
+	escaped := false
+	for _, r := range s {
+		if !escaped {
+			if r == '\u2062' {
+				escaped = true
+			} else {
+				b.WriteRune(r)
+			}
+			continue
+		}
+
+		escaped = false
+		switch r {
+		case 'e':
+			b.WriteRune('\u2062')
+		case 's':
+			b.WriteRune('\u2063')
+		case 'p':
+			b.WriteRune('\u2064')
+		case 'n':
+			b.WriteRune('\n')
+		default:
+			b.WriteRune('\u2062')
+			b.WriteRune(r)
+		}
+	}
+
+	if escaped {
+		b.WriteRune('\u2062')
+	}
+	return b.String()
+}
+
+// parseHeader returns the format version named by the first line of a store
+// file. Files written before versioning have a bare header and are v1.
+func parseHeader(line string) (int, error) {
+	if line == storeHeader {
+		return 1, nil
+	}
+
+	if !strings.HasPrefix(line, storeHeader+"v") {
+		return 0, fmt.Errorf("invalid pindb store file")
+	}
+
+	version, err := strconv.Atoi(strings.TrimPrefix(line, storeHeader+"v"))
+	if err != nil || version < 1 {
+		return 0, fmt.Errorf("invalid pindb store file version: %s", line)
+	}
+	return version, nil
+}
+
+func formatHeader(version int) string {
+	return fmt.Sprintf("%sv%d", storeHeader, version)
+}
+
+// migrate upgrades a record from version to FormatVersion. Records from a
+// newer client are left as they are.
+func migrate(version int, record string) (string, error) {
+	for v := version; v < FormatVersion; v++ {
+		m, ok := migrations[v]
+		if !ok {
+			return "", fmt.Errorf("no migration from store file version %d", v)
+		}
+
+		var err error
+		record, err = m(record)
+		if err != nil {
+			return "", fmt.Errorf("migrating from version %d: %w", v, err)
+		}
+	}
+	return record, nil
+}
+
+// unknownRecord is a record this client does not know, written by a newer
+// client. It is written back after the known record it followed, named by
+// the key of that record, or at the end when after is empty or that record
+// is gone.
+type unknownRecord struct {
+	after  string
+	record string
+}
+
+// recordKey names a known record so that it can be found again when the
+// store is written: the header and store records by their type, the others
+// by their uuid.
+func recordKey(record string) string {
+	if strings.HasPrefix(record, storeHeader) {
+		return storeHeader
+	}
+
+	parts := strings.Split(record, "\u2063")
+	switch parts[0] {
+	case "B", "L", "Q":
+		if len(parts) > 1 {
+			return parts[0] + parts[1]
+		}
+	case "G":
+		if len(parts) > 2 {
+			return parts[0] + parts[2]
+		}
+	}
+	return parts[0]
+}
+
+// unknownWriter writes the known records of a store and puts each unknown
+// record back after the record it followed.
+type unknownWriter struct {
+	w       io.Writer
+	unknown []unknownRecord
+	written map[int]bool
+	line    []byte
+}
+
+func newUnknownWriter(w io.Writer, unknown []unknownRecord) *unknownWriter {
+	return &unknownWriter{w: w, unknown: unknown, written: map[int]bool{}}
+}
+
+func (u *unknownWriter) Write(p []byte) (int, error) {
+	u.line = append(u.line, p...)
+	for {
+		i := bytes.IndexByte(u.line, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+
+		record := string(u.line[:i])
+		_, err := u.w.Write(u.line[:i+1])
+		if err != nil {
+			return 0, err
+		}
+		u.line = u.line[i+1:]
+
+		key := recordKey(record)
+		for j, r := range u.unknown {
+			if r.after != "" && r.after == key && !u.written[j] {
+				err := u.writeUnknown(j)
+				if err != nil {
+					return 0, err
+				}
+			}
+		}
+	}
+}
+
+func (u *unknownWriter) writeUnknown(i int) error {
+	u.written[i] = true
+	_, err := fmt.Fprintf(u.w, "%s\n", u.unknown[i].record)
+	return err
+}
+
+// Close writes the unknown records whose known record was not written.
+func (u *unknownWriter) Close() error {
+	if len(u.line) > 0 {
+		_, err := u.Write([]byte{'\n'})
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := range u.unknown {
+		if !u.written[i] {
+			err := u.writeUnknown(i)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
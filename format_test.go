@@ -0,0 +1,162 @@
+package pindb
+
+import (
+	"strings"
+	"testing"
+)
+
+// awkward holds every character the record format escapes.
+const awkward = "a\u2063b\u2064c\nd\u2062e \u2062s\u2062"
+
+func TestEscapeRoundTrips(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"plain",
+		"\u2063",
+		"\u2064",
+		"\n",
+		"\u2062",
+		"\u2062e",
+		"\u2062s\u2062p\u2062n",
+		"trailing\u2062",
+		awkward,
+	} {
+		e := escape(s)
+		if strings.ContainsAny(e, "\u2063\u2064\n") {
+			t.Errorf("escape(%q) = %q keeps a separator", s, e)
+		}
+
+		if got := unescape(e); got != s {
+			t.Errorf("unescape(escape(%q)) = %q", s, got)
+		}
+	}
+}
+
+func TestStoreRoundTripsSeparators(t *testing.T) {
+	m := NewMemoryBackend()
+	s, b := newTestStore(t, m)
+
+	s.Rename("store " + awkward)
+	b.Rename("bucket " + awkward)
+
+	g, err := b.AddGroup("group " + awkward)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := b.Add("link "+awkward, mustParse(t, "https://example.com"), g)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := New().ReadStream(strings.NewReader(string(s.WriteBytes())))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Name() != s.Name() {
+		t.Errorf("got store name %q, want %q", r.Name(), s.Name())
+	}
+
+	rb, err := r.Bucket(b.UUID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rb.Name() != b.Name() {
+		t.Errorf("got bucket name %q, want %q", rb.Name(), b.Name())
+	}
+
+	rl, err := rb.Link(l.UUID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rl.Title() != l.Title() {
+		t.Errorf("got title %q, want %q", rl.Title(), l.Title())
+	}
+	if rl.Group() == nil || rl.Group().Name() != g.Name() {
+		t.Errorf("got group %v, want %q", rl.Group(), g.Name())
+	}
+
+	// the post holds the link in its extended record
+	if _, err := s.Refresh(true); err != nil {
+		t.Fatal(err)
+	}
+
+	ls := b.Links()
+	if len(ls) != 1 || ls[0].Title() != "link "+awkward {
+		t.Fatalf("got %d links after refresh, want the title kept", len(ls))
+	}
+	if len(ls[0].Warnings()) != 0 {
+		t.Errorf("got warnings %v after refresh", ls[0].Warnings())
+	}
+}
+
+func TestReadsUnescapedFiles(t *testing.T) {
+	s, b := newTestStore(t, NewMemoryBackend())
+
+	l, err := b.Add("zzqq", mustParse(t, "https://example.com"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// v2 files hold the escape character as it is
+	raw := string(s.WriteBytes())
+	raw = strings.Replace(raw, formatHeader(FormatVersion), formatHeader(2), 1)
+	raw = strings.Replace(raw, "zzqq", "zz\u2062qq", 1)
+
+	r, err := New().ReadStream(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rb, err := r.Bucket(b.UUID())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rl, err := rb.Link(l.UUID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rl.Title() != "zz\u2062qq" {
+		t.Errorf("got title %q, want %q", rl.Title(), "zz\u2062qq")
+	}
+}
+
+func TestStoreKeepsUnknownRecordsInPlace(t *testing.T) {
+	s, b := newTestStore(t, NewMemoryBackend())
+
+	l, err := b.Add("link", mustParse(t, "https://example.com"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a newer client wrote records this one does not know after the bucket,
+	// after the link and at the end
+	lines := strings.SplitAfter(string(s.WriteBytes()), "\n")
+	newer := []string{formatHeader(FormatVersion+1) + "\n"}
+	for _, line := range lines[1:] {
+		newer = append(newer, line)
+		switch {
+		case strings.HasPrefix(line, "B\u2063"+b.UUID().String()):
+			newer = append(newer, "X\u2063after bucket\n")
+		case strings.HasPrefix(line, "L\u2063"+l.UUID().String()):
+			newer = append(newer, "X\u2063after link\n", "Y\u2063also after link\n")
+		}
+	}
+	newer = append(newer, "Z\u2063at the end\n")
+	raw := strings.Join(newer, "")
+
+	r, err := New().ReadStream(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Version() != FormatVersion+1 {
+		t.Errorf("got version %d, want %d", r.Version(), FormatVersion+1)
+	}
+
+	want := strings.Replace(raw, formatHeader(FormatVersion+1), formatHeader(FormatVersion), 1)
+	if got := string(r.WriteBytes()); got != want {
+		t.Errorf("got\n%q\nwant\n%q", got, want)
+	}
+}
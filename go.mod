@@ -6,6 +6,7 @@ require (
 	github.com/google/uuid v1.6.0
 	github.com/tmstn/pinboard v1.1.0
 	github.com/urfave/cli/v2 v2.27.1
+	golang.org/x/crypto v0.31.0
 )
 
 require (
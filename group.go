@@ -0,0 +1,282 @@
+package pindb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+type groups map[uuid.UUID]*Group
+
+func (g *groups) get(uuid uuid.UUID) (*Group, error) {
+	v, ok := (*g)[uuid]
+	if ok {
+		return v, nil
+	}
+
+	return nil, errors.New("group does not exist")
+}
+
+func (g *groups) has(uuid uuid.UUID) bool {
+	_, ok := (*g)[uuid]
+	return ok
+}
+
+func (g *groups) set(group *Group) {
+	(*g)[group.uuid] = group
+}
+
+func (g *groups) unset(group *Group) error {
+	if !g.has(group.uuid) {
+		return errors.New("group does not exist")
+	}
+	delete(*g, group.uuid)
+	return nil
+}
+
+func (g *groups) next() int {
+	order := 0
+	for _, v := range *g {
+		if v.order >= order {
+			order = v.order + 1
+		}
+	}
+	return order
+}
+
+func (g *groups) writeBytes() []byte {
+	var f bytes.Buffer
+	for _, v := range g.list() {
+		fmt.Fprintf(&f, "%s\n", v.record())
+	}
+	return f.Bytes()
+}
+
+// list returns the groups in display order.
+func (g *groups) list() []*Group {
+	groups := []*Group{}
+	for _, v := range *g {
+		groups = append(groups, v)
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].order != groups[j].order {
+			return groups[i].order < groups[j].order
+		}
+		if groups[i].name != groups[j].name {
+			return groups[i].name < groups[j].name
+		}
+		return groups[i].uuid.String() < groups[j].uuid.String()
+	})
+	return groups
+}
+
+func (g *groups) json() GroupsJSON {
+	j := GroupsJSON{}
+	for _, v := range g.list() {
+		j = append(j, v.json())
+	}
+	return j
+}
+
+func newGroups() *groups {
+	return &groups{}
+}
+
+type Group struct {
+	uuid   uuid.UUID
+	name   string
+	order  int
+	bucket *Bucket
+}
+
+func (g *Group) UUID() uuid.UUID {
+	return g.uuid
+}
+
+func (g *Group) Name() string {
+	g.bucket.store.mu.RLock()
+	defer g.bucket.store.mu.RUnlock()
+	return g.name
+}
+
+func (g *Group) Order() int {
+	g.bucket.store.mu.RLock()
+	defer g.bucket.store.mu.RUnlock()
+	return g.order
+}
+
+func (g *Group) Bucket() *Bucket {
+	return g.bucket
+}
+
+func (g *Group) Tag() Tag {
+	return groupTag(g.bucket.uuid, g.uuid.String())
+}
+
+func (g *Group) Links() []*Link {
+	g.bucket.store.mu.RLock()
+	defer g.bucket.store.mu.RUnlock()
+	return g.links()
+}
+
+func (g *Group) links() []*Link {
+	links := []*Link{}
+	for _, l := range g.bucket.links.list() {
+		if l.group.Is(g.Tag()) {
+			links = append(links, l)
+		}
+	}
+	return links
+}
+
+// Rename only changes the local name, links are tagged by the group uuid.
+func (g *Group) Rename(name string) (*Group, error) {
+	g.bucket.store.mu.Lock()
+	defer g.bucket.store.mu.Unlock()
+
+	g.name = name
+	return g, nil
+}
+
+func (g *Group) SetOrder(order int) *Group {
+	g.bucket.store.mu.Lock()
+	defer g.bucket.store.mu.Unlock()
+
+	g.order = order
+	return g
+}
+
+// Remove takes every link out of the group and deletes the group.
+func (g *Group) Remove() error {
+	return g.RemoveContext(context.Background())
+}
+
+func (g *Group) RemoveContext(ctx context.Context) error {
+	return g.bucket.store.change(ctx, func() error {
+		for _, l := range g.links() {
+			l.unsetGroup()
+		}
+		return g.bucket.groups.unset(g)
+	})
+}
+
+func (g *Group) JSON() GroupJSON {
+	g.bucket.store.mu.RLock()
+	defer g.bucket.store.mu.RUnlock()
+	return g.json()
+}
+
+func (g *Group) json() GroupJSON {
+	j := GroupJSON{}
+	j.UUID = g.uuid.String()
+	j.Name = g.name
+	j.Order = g.order
+	j.Tag = g.Tag().String()
+	return j
+}
+
+func (g *Group) record() []byte {
+	return []byte(fmt.Sprintf(
+		"G\u2063%s\u2063%s\u2063%d\u2063%s",
+		g.bucket.uuid.String(),
+		g.uuid.String(),
+		g.order,
+		escape(g.name)))
+}
+
+func newGroup(bucket *Bucket, name string) (*Group, error) {
+	return &Group{
+		uuid:   uuid.New(),
+		name:   name,
+		order:  bucket.groups.next(),
+		bucket: bucket,
+	}, nil
+}
+
+func parseGroup(store *Store, parts []string) (*Group, error) {
+	if len(parts) != 4 {
+		return nil, errors.New("invalid group record")
+	}
+
+	buid, err := uuid.Parse(parts[0])
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := store.buckets.get(buid)
+	if err != nil {
+		return nil, err
+	}
+
+	uid, err := uuid.Parse(parts[1])
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return nil, err
+	}
+
+	return &Group{
+		uuid:   uid,
+		name:   unescape(parts[3]),
+		order:  order,
+		bucket: b,
+	}, nil
+}
+
+func groupTag(bucket uuid.UUID, id string) Tag {
+	return NewTag(fmt.Sprintf("/pindb/bucket:\"%s\"/group:\"%s\"", bucket.String(), id))
+}
+
+// ensureGroup returns the group a link group tag points at, adding an
+// unnamed group for tags that are not known yet. Tags written before groups
+// were named may hold just the group id, which is normalised to the full
+// group tag.
+func (b *Bucket) ensureGroup(tag Tag) (*Group, Tag) {
+	if strings.TrimSpace(tag.String()) == "" {
+		return nil, tag
+	}
+
+	id := tag.String()
+	rg := regexp.MustCompile(fmt.Sprintf(`^/pindb/bucket:\"%s\"/group:\"(.+)\"$`, b.uuid.String()))
+	if rg.MatchString(id) {
+		id = rg.FindStringSubmatch(id)[1]
+	}
+
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		uid = uuid.NewSHA1(b.uuid, []byte(id))
+	}
+
+	g, err := b.groups.get(uid)
+	if err != nil {
+		g = &Group{
+			uuid:   uid,
+			name:   id,
+			order:  b.groups.next(),
+			bucket: b,
+		}
+		b.groups.set(g)
+	}
+
+	return g, g.Tag()
+}
+
+type GroupsJSON []GroupJSON
+
+type GroupJSON struct {
+	UUID  string `json:"uuid,omitempty"`
+	Name  string `json:"name,omitempty"`
+	Order int    `json:"order"`
+	Tag   string `json:"tag,omitempty"`
+}
@@ -0,0 +1,159 @@
+package pindb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	historyDir    = ".pindb-history"
+	historyLayout = "20060102T150405.000000000Z"
+)
+
+// Snapshot is a previous version of a store file.
+type Snapshot struct {
+	name    string
+	path    string
+	takenAt time.Time
+}
+
+// Name identifies the snapshot for Rollback.
+func (s *Snapshot) Name() string {
+	return s.name
+}
+
+func (s *Snapshot) Path() string {
+	return s.path
+}
+
+func (s *Snapshot) TakenAt() time.Time {
+	return s.takenAt
+}
+
+func (s *Snapshot) JSON() SnapshotJSON {
+	j := SnapshotJSON{}
+	j.Name = s.name
+	j.Path = s.path
+	j.TakenAt = s.takenAt.Format(time.RFC3339)
+	return j
+}
+
+// historyPath is the directory holding the snapshots of the store file at
+// path, .pindb-history/<file name> next to it.
+func historyPath(path string) string {
+	dir, name := filepath.Split(path)
+	return filepath.Join(dir, historyDir, name)
+}
+
+// snapshot copies the store file at path into its history and drops the
+// oldest snapshots beyond keep.
+func snapshot(path string, keep int) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	dir := historyPath(path)
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+
+	name := time.Now().UTC().Format(historyLayout)
+	err = writeFile(filepath.Join(dir, name), 0, writeBytes(data))
+	if err != nil {
+		return err
+	}
+
+	snapshots, err := History(path)
+	if err != nil {
+		return err
+	}
+
+	for i := keep; i < len(snapshots); i++ {
+		err = os.Remove(snapshots[i].path)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// History lists the snapshots of the store file at path, newest first.
+func History(path string) ([]*Snapshot, error) {
+	dir := historyPath(path)
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []*Snapshot{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := []*Snapshot{}
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+
+		t, err := time.Parse(historyLayout, e.Name())
+		if err != nil {
+			continue
+		}
+
+		snapshots = append(snapshots, &Snapshot{
+			name:    e.Name(),
+			path:    filepath.Join(dir, e.Name()),
+			takenAt: t,
+		})
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].name > snapshots[j].name
+	})
+	return snapshots, nil
+}
+
+// Rollback restores the store file at path to the snapshot called name. The
+// version it replaces becomes a snapshot itself, so a rollback can be undone,
+// and no snapshot is dropped whatever WithHistory keeps.
+func (c *Client) Rollback(path, name string) error {
+	snapshots, err := History(path)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range snapshots {
+		if s.name != name {
+			continue
+		}
+
+		data, err := os.ReadFile(s.path)
+		if err != nil {
+			return err
+		}
+
+		// nothing is pruned, the replaced version is only added
+		keep := c.keep()
+		if keep < len(snapshots)+1 {
+			keep = len(snapshots) + 1
+		}
+		return writeFile(path, keep, writeBytes(data))
+	}
+
+	return fmt.Errorf("snapshot does not exist: %s", name)
+}
+
+type SnapshotsJSON []SnapshotJSON
+
+type SnapshotJSON struct {
+	Name    string `json:"name,omitempty"`
+	Path    string `json:"path,omitempty"`
+	TakenAt string `json:"taken_at,omitempty"`
+}
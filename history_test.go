@@ -0,0 +1,116 @@
+package pindb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteKeepsHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.pindb")
+	s, err := New(WithBackend(NewMemoryBackend()), WithHistory(2)).Add("user:token", "v0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"v0", "v1", "v2", "v3"} {
+		s.Rename(name)
+		if err := s.Write(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	snapshots, err := History(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 2 {
+		t.Fatalf("got %d snapshots, want 2", len(snapshots))
+	}
+
+	// newest first
+	for i, want := range []string{"v2", "v1"} {
+		r, err := New().Read(snapshots[i].Path())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Name() != want {
+			t.Errorf("got snapshot %d of %q, want %q", i, r.Name(), want)
+		}
+	}
+}
+
+func TestRollbackKeepsHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.pindb")
+	s, err := New(WithBackend(NewMemoryBackend()), WithHistory(5)).Add("user:token", "v0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"v0", "v1", "v2", "v3"} {
+		s.Rename(name)
+		if err := s.Write(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	before, err := History(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(before) != 3 {
+		t.Fatalf("got %d snapshots, want 3", len(before))
+	}
+
+	// a client that keeps no history must not prune it either
+	oldest := before[len(before)-1]
+	if err := New().Rollback(path, oldest.Name()); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := New().Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Name() != "v0" {
+		t.Errorf("got %q after rollback, want v0", r.Name())
+	}
+
+	after, err := History(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != len(before)+1 {
+		t.Fatalf("got %d snapshots after rollback, want %d", len(after), len(before)+1)
+	}
+
+	// the replaced version can be rolled back to
+	replaced, err := New().Read(after[0].Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replaced.Name() != "v3" {
+		t.Errorf("got %q as the newest snapshot, want v3", replaced.Name())
+	}
+
+	for _, s := range before {
+		if _, err := os.Stat(s.Path()); err != nil {
+			t.Errorf("snapshot %s was dropped: %v", s.Name(), err)
+		}
+	}
+}
+
+func TestRollbackToMissingSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.pindb")
+	s, err := New(WithBackend(NewMemoryBackend())).Add("user:token", "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Write(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := New().Rollback(path, "missing"); err == nil {
+		t.Fatal("rolled back to a snapshot that does not exist")
+	}
+}
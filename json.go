@@ -0,0 +1,400 @@
+package pindb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// The JSON export of a store holds everything its file does, so a store can
+// be rebuilt from it. Fields derived from others, such as the username,
+// warnings or group tags, are written for readers but ignored when reading.
+// Unmarshalling rejects unknown fields and malformed values so that a
+// mistake in a hand edited export is reported instead of dropped.
+
+// decodeJSON decodes data into v, rejecting fields v does not have.
+func decodeJSON(data []byte, v any) error {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.DisallowUnknownFields()
+	return d.Decode(v)
+}
+
+func parseTimestamp(text string) (*time.Time, error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, text)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (j StoreJSON) MarshalJSON() ([]byte, error) {
+	type storeJSON StoreJSON
+	return json.Marshal(storeJSON(j))
+}
+
+func (j *StoreJSON) UnmarshalJSON(data []byte) error {
+	type storeJSON StoreJSON
+	err := decodeJSON(data, (*storeJSON)(j))
+	if err != nil {
+		return err
+	}
+
+	if _, err := uuid.Parse(j.UUID); err != nil {
+		return fmt.Errorf("store uuid: %s", err.Error())
+	}
+
+	if _, err := parseTimestamp(j.RefreshedAt); err != nil {
+		return fmt.Errorf("store refreshed_at: %s", err.Error())
+	}
+
+	if j.Untracked < 0 {
+		return errors.New("store untracked cannot be negative")
+	}
+
+	if j.Version < 0 {
+		return errors.New("store version cannot be negative")
+	}
+
+	for _, r := range j.Unknown {
+		if strings.Contains(r, "\n") {
+			return errors.New("store unknown records cannot contain newlines")
+		}
+	}
+	return nil
+}
+
+func (j UserJSON) MarshalJSON() ([]byte, error) {
+	type userJSON UserJSON
+	return json.Marshal(userJSON(j))
+}
+
+func (j *UserJSON) UnmarshalJSON(data []byte) error {
+	type userJSON UserJSON
+	err := decodeJSON(data, (*userJSON)(j))
+	if err != nil {
+		return err
+	}
+
+	_, err = newUser(j.Token)
+	return err
+}
+
+func (j BucketJSON) MarshalJSON() ([]byte, error) {
+	type bucketJSON BucketJSON
+	return json.Marshal(bucketJSON(j))
+}
+
+func (j *BucketJSON) UnmarshalJSON(data []byte) error {
+	type bucketJSON BucketJSON
+	err := decodeJSON(data, (*bucketJSON)(j))
+	if err != nil {
+		return err
+	}
+
+	if _, err := uuid.Parse(j.UUID); err != nil {
+		return fmt.Errorf("bucket uuid: %s", err.Error())
+	}
+
+	if _, err := parseTimestamp(j.RefreshedAt); err != nil {
+		return fmt.Errorf("bucket %s refreshed_at: %s", j.UUID, err.Error())
+	}
+	return nil
+}
+
+func (j GroupJSON) MarshalJSON() ([]byte, error) {
+	type groupJSON GroupJSON
+	return json.Marshal(groupJSON(j))
+}
+
+func (j *GroupJSON) UnmarshalJSON(data []byte) error {
+	type groupJSON GroupJSON
+	err := decodeJSON(data, (*groupJSON)(j))
+	if err != nil {
+		return err
+	}
+
+	if _, err := uuid.Parse(j.UUID); err != nil {
+		return fmt.Errorf("group uuid: %s", err.Error())
+	}
+	return nil
+}
+
+func (j LinkJSON) MarshalJSON() ([]byte, error) {
+	type linkJSON LinkJSON
+	return json.Marshal(linkJSON(j))
+}
+
+func (j *LinkJSON) UnmarshalJSON(data []byte) error {
+	type linkJSON LinkJSON
+	err := decodeJSON(data, (*linkJSON)(j))
+	if err != nil {
+		return err
+	}
+
+	if _, err := uuid.Parse(j.UUID); err != nil {
+		return fmt.Errorf("link uuid: %s", err.Error())
+	}
+
+	if _, err := url.Parse(j.Url); err != nil {
+		return fmt.Errorf("link %s url: %s", j.UUID, err.Error())
+	}
+
+	if _, err := NewTag(j.Group).Validate(); err != nil {
+		return fmt.Errorf("link %s group: %s", j.UUID, err.Error())
+	}
+
+	for _, t := range j.Tags {
+		if _, err := NewTag(t).Validate(); err != nil {
+			return fmt.Errorf("link %s tag %q: %s", j.UUID, t, err.Error())
+		}
+	}
+	return nil
+}
+
+func (j OperationJSON) MarshalJSON() ([]byte, error) {
+	type operationJSON OperationJSON
+	return json.Marshal(operationJSON(j))
+}
+
+func (j *OperationJSON) UnmarshalJSON(data []byte) error {
+	type operationJSON OperationJSON
+	err := decodeJSON(data, (*operationJSON)(j))
+	if err != nil {
+		return err
+	}
+
+	_, err = operationFromJSON(*j)
+	return err
+}
+
+// readJSON rebuilds a store from its JSON export.
+func (s *stores) readJSON(r io.Reader) (*Store, error) {
+	j := StoreJSON{}
+	err := json.NewDecoder(r).Decode(&j)
+	if err != nil {
+		return nil, err
+	}
+
+	return storeFromJSON(j)
+}
+
+func storeFromJSON(j StoreJSON) (*Store, error) {
+	uid, err := uuid.Parse(j.UUID)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := parseTimestamp(j.RefreshedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := newUser(j.User.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &Store{
+		refreshedAt: t,
+		user:        u,
+		name:        j.Name,
+		uuid:        uid,
+		buckets:     newBuckets(),
+		queue:       newOperations(),
+		untracked:   j.Untracked,
+		manifest:    j.Manifest,
+		version:     FormatVersion,
+		unknown:     []unknownRecord{},
+	}
+
+	if j.Version > 0 {
+		v.version = j.Version
+	}
+
+	// the JSON does not say where the records were, so they go at the end
+	for _, r := range j.Unknown {
+		v.unknown = append(v.unknown, unknownRecord{record: r})
+	}
+
+	for _, bj := range j.Buckets {
+		b, err := bucketFromJSON(v, bj)
+		if err != nil {
+			return nil, fmt.Errorf("bucket %s: %s", bj.UUID, err.Error())
+		}
+
+		if v.buckets.has(b.uuid) {
+			return nil, fmt.Errorf("bucket %s: duplicate uuid", bj.UUID)
+		}
+		v.buckets.set(b)
+	}
+
+	for _, oj := range j.Pending {
+		op, err := operationFromJSON(oj)
+		if err != nil {
+			return nil, fmt.Errorf("pending %s: %s", oj.UUID, err.Error())
+		}
+
+		err = v.pending(op)
+		if err != nil {
+			return nil, fmt.Errorf("pending %s: %s", oj.UUID, err.Error())
+		}
+
+		v.queue.add(op)
+	}
+
+	return v, nil
+}
+
+// pending checks that op can be pushed from the store. Adds and replaces
+// read the link they push, so its bucket and the link must exist. A delete
+// outlives its link and needs only the url.
+func (s *Store) pending(op *Operation) error {
+	if op.kind == DeleteOperation {
+		if op.url == "" {
+			return errors.New("delete without a url")
+		}
+		return nil
+	}
+
+	b, err := s.buckets.get(op.bucket)
+	if err != nil {
+		return fmt.Errorf("bucket %s is not in the store", op.bucket)
+	}
+
+	if !b.links.has(op.link) {
+		return fmt.Errorf("link %s is not in bucket %s", op.link, op.bucket)
+	}
+	return nil
+}
+
+func bucketFromJSON(store *Store, j BucketJSON) (*Bucket, error) {
+	uid, err := uuid.Parse(j.UUID)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := parseTimestamp(j.RefreshedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := newBucket(store, j.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	b.uuid = uid
+	b.refreshedAt = t
+
+	for _, gj := range j.Groups {
+		gid, err := uuid.Parse(gj.UUID)
+		if err != nil {
+			return nil, fmt.Errorf("group %s: %s", gj.UUID, err.Error())
+		}
+
+		if b.groups.has(gid) {
+			return nil, fmt.Errorf("group %s: duplicate uuid", gj.UUID)
+		}
+
+		b.groups.set(&Group{
+			uuid:   gid,
+			name:   gj.Name,
+			order:  gj.Order,
+			bucket: b,
+		})
+	}
+
+	for _, lj := range j.Links {
+		l, err := linkFromJSON(b, lj)
+		if err != nil {
+			return nil, fmt.Errorf("link %s: %s", lj.UUID, err.Error())
+		}
+
+		if b.links.has(l.uuid) {
+			return nil, fmt.Errorf("link %s: duplicate uuid", lj.UUID)
+		}
+		b.links.set(l)
+	}
+
+	return b, nil
+}
+
+func linkFromJSON(bucket *Bucket, j LinkJSON) (*Link, error) {
+	uid, err := uuid.Parse(j.UUID)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := url.Parse(j.Url)
+	if err != nil {
+		return nil, err
+	}
+
+	group := NewTag(j.Group)
+	if strings.TrimSpace(j.Group) != "" {
+		found := false
+		for _, g := range bucket.groups.list() {
+			if g.Tag().Is(group) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("group %s is not in the bucket", j.Group)
+		}
+	}
+
+	l, err := newLink(bucket, j.Title, u, group, newTags().populate(j.Tags...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	l.uuid = uid
+	l.description = l.record()
+	l.validate()
+	return l, nil
+}
+
+func operationFromJSON(j OperationJSON) (*Operation, error) {
+	uid, err := uuid.Parse(j.UUID)
+	if err != nil {
+		return nil, err
+	}
+
+	kind := OperationKind(j.Kind)
+	switch kind {
+	case AddOperation, ReplaceOperation, DeleteOperation:
+	default:
+		return nil, fmt.Errorf("unknown queue operation: %s", j.Kind)
+	}
+
+	buid, err := uuid.Parse(j.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	luid, err := uuid.Parse(j.Link)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Operation{
+		uuid:   uid,
+		kind:   kind,
+		bucket: buid,
+		link:   luid,
+		url:    j.Url,
+	}, nil
+}
@@ -0,0 +1,124 @@
+package pindb
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func readJSON(t *testing.T, c *Client, j StoreJSON) (*Store, error) {
+	t.Helper()
+
+	data, err := json.Marshal(j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.ReadJSON(bytes.NewReader(data))
+}
+
+func TestJSONRoundTrips(t *testing.T) {
+	s, b := newTestStore(t, NewMemoryBackend())
+
+	g, err := b.AddGroup("group")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := b.Add("link", mustParse(t, "https://example.com"), g)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := readJSON(t, New(), s.JSON())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.UUID() != s.UUID() || r.Name() != s.Name() {
+		t.Errorf("got store %s %q, want %s %q", r.UUID(), r.Name(), s.UUID(), s.Name())
+	}
+
+	rb, err := r.Bucket(b.UUID())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rl, err := rb.Link(l.UUID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rl.Title() != l.Title() || rl.URL(true).String() != l.URL(true).String() {
+		t.Errorf("got link %q at %s, want %q at %s", rl.Title(), rl.URL(true), l.Title(), l.URL(true))
+	}
+	if rl.Group() == nil || rl.Group().UUID() != g.UUID() {
+		t.Errorf("got group %v, want %s", rl.Group(), g.UUID())
+	}
+}
+
+func TestJSONKeepsDeletesOfRemovedBuckets(t *testing.T) {
+	m := NewMemoryBackend()
+	s, b := newTestStore(t, m)
+
+	l, err := b.Add("link", mustParse(t, "https://example.com"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := l.URL(true).String()
+
+	// in a transaction the links of a removed bucket are deleted on commit
+	tx, err := s.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	if _, err := b.Remove(true, false); err != nil {
+		t.Fatal(err)
+	}
+
+	j := s.JSON()
+	if len(j.Buckets) != 0 || len(j.Pending) != 1 {
+		t.Fatalf("got %d buckets and %d pending, want 0 and 1", len(j.Buckets), len(j.Pending))
+	}
+
+	r, err := readJSON(t, New(WithBackend(m)), j)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p := r.Pending(); len(p) != 1 || p[0].Kind() != DeleteOperation {
+		t.Fatalf("got %v pending, want the delete", p)
+	}
+
+	if _, err := r.Push(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.posts[u]; ok {
+		t.Error("the post was not deleted")
+	}
+}
+
+func TestJSONRejectsAddsOfMissingLinks(t *testing.T) {
+	m := NewMemoryBackend()
+	s, b := newTestStore(t, m)
+
+	tx, err := s.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	if _, err := b.Add("link", mustParse(t, "https://example.com"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	j := s.JSON()
+	if len(j.Pending) != 1 || len(j.Buckets) != 1 {
+		t.Fatalf("got %d buckets and %d pending, want 1 and 1", len(j.Buckets), len(j.Pending))
+	}
+	j.Buckets[0].Links = nil
+
+	if _, err := readJSON(t, New(WithBackend(m)), j); err == nil {
+		t.Error("read an add of a link that is not in the store")
+	}
+}
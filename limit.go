@@ -0,0 +1,115 @@
+package pindb
+
+import (
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Pinboard asks clients to space most calls 3 seconds apart, calls to
+// posts/recent a minute apart and calls to posts/all 5 minutes apart, and
+// answers 429 to those that do not.
+const (
+	DefaultRateLimit       = 3 * time.Second
+	DefaultRecentRateLimit = time.Minute
+	DefaultAllRateLimit    = 5 * time.Minute
+
+	// DefaultRetries is how many times a call that failed with 429 or a
+	// server error is retried, waiting DefaultBackoff before the first retry
+	// and twice as long before each one after it.
+	DefaultRetries = 4
+	DefaultBackoff = 3 * time.Second
+)
+
+// limits is how the calls of an account are spaced and retried.
+type limits struct {
+	interval time.Duration
+	recent   time.Duration
+	all      time.Duration
+	retries  int
+	backoff  time.Duration
+	logger   *log.Logger
+}
+
+func (l limits) logf(format string, v ...any) {
+	if l.logger != nil {
+		l.logger.Printf(format, v...)
+	}
+}
+
+// spacing is how far apart calls to endpoint must be on top of interval.
+func (l limits) spacing(endpoint string) time.Duration {
+	switch endpoint {
+	case "posts/recent":
+		return l.recent
+	case "posts/all":
+		return l.all
+	}
+	return 0
+}
+
+// delay is how long to wait before the given retry, counting from one.
+func (l limits) delay(retry int) time.Duration {
+	return l.backoff << (retry - 1)
+}
+
+func newLimits() limits {
+	return limits{
+		interval: DefaultRateLimit,
+		recent:   DefaultRecentRateLimit,
+		all:      DefaultAllRateLimit,
+		retries:  DefaultRetries,
+		backoff:  DefaultBackoff,
+	}
+}
+
+// pacing holds the intervals set by options, nil where the default of the
+// backend applies.
+type pacing struct {
+	interval *time.Duration
+	recent   *time.Duration
+	all      *time.Duration
+}
+
+// apply sets the intervals of l. Those not set are Pinboard's for Pinboard
+// and none for other backends.
+func (p pacing) apply(l *limits, pinboard bool) {
+	set := func(d *time.Duration, v *time.Duration, def time.Duration) {
+		switch {
+		case v != nil:
+			*d = *v
+		case pinboard:
+			*d = def
+		default:
+			*d = 0
+		}
+	}
+
+	set(&l.interval, p.interval, DefaultRateLimit)
+	set(&l.recent, p.recent, DefaultRecentRateLimit)
+	set(&l.all, p.all, DefaultAllRateLimit)
+}
+
+// the pinboard client reports an unexpected status only in its message
+var statusError = regexp.MustCompile(`^error: http (\d{3})$`)
+
+// status returns the status of the response err reports, 0 when err is not
+// an unexpected response.
+func status(err error) int {
+	m := statusError.FindStringSubmatch(err.Error())
+	if m == nil {
+		return 0
+	}
+
+	code, _ := strconv.Atoi(m[1])
+	return code
+}
+
+// retryable reports whether err is a response that asks for the call to be
+// made again later: too many requests or a server error.
+func retryable(err error) bool {
+	code := status(err)
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
@@ -1,11 +1,13 @@
 package pindb
 
 import (
-	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net/url"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/google/uuid"
@@ -40,26 +42,42 @@ func (l *links) unset(link *Link) error {
 	return nil
 }
 
-func (l *links) writeBytes() []byte {
-	var f bytes.Buffer
-	for _, v := range *l {
-		fmt.Fprintf(&f, "%s\n", v.record())
+func (l *links) writeTo(w io.Writer) error {
+	for _, v := range l.list() {
+		_, err := fmt.Fprintf(w, "%s\n", v.record())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *links) copy() *links {
+	c := links{}
+	for k, v := range *l {
+		c[k] = v
 	}
-	return f.Bytes()
+	return &c
 }
 
+// list returns the links ordered by uuid, which does not change when a link
+// is edited.
 func (l *links) list() []*Link {
 	links := []*Link{}
 	for _, v := range *l {
 		links = append(links, v)
 	}
+
+	sort.Slice(links, func(i, j int) bool {
+		return links[i].uuid.String() < links[j].uuid.String()
+	})
 	return links
 }
 
 func (l *links) json() LinksJSON {
 	j := LinksJSON{}
 	for _, v := range l.list() {
-		j = append(j, v.JSON())
+		j = append(j, v.json())
 	}
 	return j
 }
@@ -84,42 +102,164 @@ func (l *Link) UUID() uuid.UUID {
 }
 
 func (l *Link) Title() string {
+	l.bucket.store.mu.RLock()
+	defer l.bucket.store.mu.RUnlock()
 	return l.title
 }
 
-func (l *Link) Group() Tag {
-	return l.group
-}
+// Group returns the group of the link, nil when it has none.
+func (l *Link) Group() *Group {
+	l.bucket.store.mu.RLock()
+	defer l.bucket.store.mu.RUnlock()
 
-func (l *Link) SetGroup(group Tag) (*Link, error) {
-	if !strings.HasPrefix(group.String(), fmt.Sprintf("/pindb/bucket:\"%s\"/group:\"", l.bucket.uuid.String())) {
-		group = Tag(fmt.Sprintf("/pindb/bucket:\"%s\"/group:\"%s\"", l.bucket.uuid.String(), group.String()))
+	if strings.TrimSpace(l.group.String()) == "" {
+		return nil
 	}
 
-	l.tags.remove(l.group)
-	l.group = group
-	err := l.bucket.store.pb.Posts.Add(l.Options(true))
-	if err != nil {
-		return l, err
+	for _, g := range *l.bucket.groups {
+		if l.group.Is(g.Tag()) {
+			return g
+		}
 	}
-	l.description = l.record()
-	return l, nil
+	return nil
+}
+
+func (l *Link) SetGroup(group *Group) (*Link, error) {
+	return l.SetGroupContext(context.Background(), group)
+}
+
+func (l *Link) SetGroupContext(ctx context.Context, group *Group) (*Link, error) {
+	if group == nil {
+		return l, errors.New("no group given, use UnsetGroup to remove the link from its group")
+	}
+
+	err := l.bucket.store.change(ctx, func() error {
+		if group.bucket != l.bucket {
+			return errors.New("group belongs to another bucket")
+		}
+
+		l.tags.remove(l.group)
+		l.group = group.Tag()
+		l.options(true)
+		l.bucket.store.enqueue(newOperation(ReplaceOperation, l))
+		return nil
+	})
+	return l, err
 }
 
 func (l *Link) UnsetGroup() (*Link, error) {
+	return l.UnsetGroupContext(context.Background())
+}
+
+func (l *Link) UnsetGroupContext(ctx context.Context) (*Link, error) {
+	err := l.bucket.store.change(ctx, func() error {
+		l.unsetGroup()
+		return nil
+	})
+	return l, err
+}
+
+func (l *Link) unsetGroup() {
 	l.tags.remove(l.group)
 	l.group = NewTag("")
-	err := l.bucket.store.pb.Posts.Add(l.Options(true))
-	if err != nil {
-		return l, err
+	l.options(true)
+	l.bucket.store.enqueue(newOperation(ReplaceOperation, l))
+}
+
+func (l *Link) SetTitle(title string) (*Link, error) {
+	return l.SetTitleContext(context.Background(), title)
+}
+
+func (l *Link) SetTitleContext(ctx context.Context, title string) (*Link, error) {
+	err := l.bucket.store.change(ctx, func() error {
+		l.title = title
+		l.options(true)
+		l.bucket.store.enqueue(newOperation(ReplaceOperation, l))
+		return nil
+	})
+	return l, err
+}
+
+// SetURL moves the link to u. The link keeps its uuid and the post at the
+// old url is deleted once the new one has been pushed.
+func (l *Link) SetURL(u *url.URL) (*Link, error) {
+	return l.SetURLContext(context.Background(), u)
+}
+
+func (l *Link) SetURLContext(ctx context.Context, u *url.URL) (*Link, error) {
+	err := l.bucket.store.change(ctx, func() error {
+		l.setURL(u)
+		return nil
+	})
+	return l, err
+}
+
+func (l *Link) setURL(u *url.URL) {
+	n := *u
+	q := n.Query()
+	q.Set("pindbuuid", l.uuid.String())
+	n.RawQuery = q.Encode()
+	if n.String() == l.url.String() {
+		return
+	}
+
+	old := newOperation(DeleteOperation, l)
+	queue := l.bucket.store.queue
+	unpushed := queue.unpushed(l.uuid)
+
+	l.url = &n
+	queue.retarget(l.uuid, n.String())
+	l.options(true)
+	l.bucket.store.enqueue(newOperation(ReplaceOperation, l))
+	if !unpushed {
+		l.bucket.store.enqueue(old)
 	}
-	l.description = l.record()
-	return l, nil
+}
+
+func (l *Link) AddTags(tags ...Tag) (*Link, error) {
+	return l.AddTagsContext(context.Background(), tags...)
+}
+
+func (l *Link) AddTagsContext(ctx context.Context, tags ...Tag) (*Link, error) {
+	for _, tag := range tags {
+		_, err := tag.Validate()
+		if err != nil {
+			return l, err
+		}
+	}
+
+	err := l.bucket.store.change(ctx, func() error {
+		l.tags.add(tags...)
+		l.options(true)
+		l.bucket.store.enqueue(newOperation(ReplaceOperation, l))
+		return nil
+	})
+	return l, err
+}
+
+// RemoveTags removes tags from the link. The store, bucket and group tags
+// are managed by pindb and are kept.
+func (l *Link) RemoveTags(tags ...Tag) (*Link, error) {
+	return l.RemoveTagsContext(context.Background(), tags...)
+}
+
+func (l *Link) RemoveTagsContext(ctx context.Context, tags ...Tag) (*Link, error) {
+	err := l.bucket.store.change(ctx, func() error {
+		l.tags.remove(tags...)
+		l.options(true)
+		l.bucket.store.enqueue(newOperation(ReplaceOperation, l))
+		return nil
+	})
+	return l, err
 }
 
 func (l *Link) URL(detail bool) *url.URL {
+	l.bucket.store.mu.RLock()
+	defer l.bucket.store.mu.RUnlock()
+
 	if detail {
-		return l.url
+		r := *l.url
+		return &r
 	} else {
 		r := *l.url
 		r.Query().Del("pindbuuid")
@@ -129,44 +269,73 @@ func (l *Link) URL(detail bool) *url.URL {
 }
 
 func (l *Link) Tags(detail bool) Tags {
+	l.bucket.store.mu.RLock()
+	defer l.bucket.store.mu.RUnlock()
+
 	if detail {
-		return l.tags
+		return append(newTags(), l.tags...)
 	} else {
-		rgs := regexp.MustCompile(`^/pindb/store:\"[0-9a-f\-]+\"$`)
-		rgb := regexp.MustCompile(`^/pindb/store:\"[0-9a-f\-]+\"/bucket:\"[0-9a-f\-]+\"$`)
-		rgg := regexp.MustCompile(`^/pindb/bucket:\"([0-9a-f\-]+)\"/group:\"([0-9a-f\-]+)\"$`)
-
-		s := newTags()
-		for _, t := range l.tags {
-			if rgs.MatchString(t.String()) {
-				continue
-			} else if rgb.MatchString(t.String()) {
-				continue
-			} else if rgg.MatchString(t.String()) {
-				continue
-			}
+		return l.userTags()
+	}
+}
 
-			s = append(s, t)
+// userTags returns the tags of the link that pindb does not manage.
+func (l *Link) userTags() Tags {
+	rgs := regexp.MustCompile(`^/pindb/store:\"[0-9a-f\-]+\"$`)
+	rgb := regexp.MustCompile(`^/pindb/store:\"[0-9a-f\-]+\"/bucket:\"[0-9a-f\-]+\"$`)
+	rgg := regexp.MustCompile(`^/pindb/bucket:\"([0-9a-f\-]+)\"/group:\"([0-9a-f\-]+)\"$`)
+
+	s := newTags()
+	for _, t := range l.tags {
+		if rgs.MatchString(t.String()) {
+			continue
+		} else if rgb.MatchString(t.String()) {
+			continue
+		} else if rgg.MatchString(t.String()) {
+			continue
 		}
 
-		return s
+		s = append(s, t)
 	}
+
+	return s
 }
 
 func (l *Link) Warnings() Warnings {
-	return l.warnings
+	l.bucket.store.mu.RLock()
+	defer l.bucket.store.mu.RUnlock()
+	return append(newWarnings(), l.warnings...)
+}
+
+// Dirty reports whether the link has changes that have not been pushed.
+func (l *Link) Dirty() bool {
+	l.bucket.store.mu.RLock()
+	defer l.bucket.store.mu.RUnlock()
+	return l.bucket.store.queue.has(l.uuid)
 }
 
 func (l *Link) Remove() error {
-	err := l.bucket.store.user.pb.Posts.Delete(l.url.String())
-	if err != nil {
-		return err
-	}
-	l.bucket.links.unset(l)
-	return nil
+	return l.RemoveContext(context.Background())
+}
+
+func (l *Link) RemoveContext(ctx context.Context) error {
+	return l.bucket.store.change(ctx, func() error {
+		err := l.bucket.links.unset(l)
+		if err != nil {
+			return err
+		}
+		l.bucket.store.enqueue(newOperation(DeleteOperation, l))
+		return nil
+	})
 }
 
 func (l *Link) Validate() bool {
+	l.bucket.store.mu.Lock()
+	defer l.bucket.store.mu.Unlock()
+	return l.validate()
+}
+
+func (l *Link) validate() bool {
 	warnings := newWarnings()
 
 	if string(l.description) != string(l.record()) {
@@ -207,8 +376,8 @@ func (l *Link) Validate() bool {
 			warnings = append(warnings, NewWarning(MultiplePinDBGroupTagWarning, &t))
 		}
 	}
-	if len(ugt) > 01 {
-		for _, t := range gt {
+	if len(ugt) > 0 {
+		for _, t := range ugt {
 			warnings = append(warnings, NewWarning(UnrelatedPinDBGroupTagWarning, &t))
 		}
 	}
@@ -216,7 +385,15 @@ func (l *Link) Validate() bool {
 	return len(l.warnings) == 0
 }
 
+// Options brings the pindb tags and record of the link up to date and
+// returns it as a post.
 func (l *Link) Options(replace bool) *pinboard.PostsAddOptions {
+	l.bucket.store.mu.Lock()
+	defer l.bucket.store.mu.Unlock()
+	return l.options(replace)
+}
+
+func (l *Link) options(replace bool) *pinboard.PostsAddOptions {
 	l.tags.add(l.bucket.Tag())
 	l.tags.add(l.bucket.store.Tag())
 	l.description = l.record()
@@ -237,11 +414,96 @@ func (l *Link) Options(replace bool) *pinboard.PostsAddOptions {
 	return opts
 }
 
-func (l *Link) Fix(warning Warning) (*Link, error) {
-	return nil, nil
+// Fix repairs the link for each of warnings and pushes it once. A warning
+// about an unrelated tag without a tag repairs every tag of its category.
+func (l *Link) Fix(warnings ...Warning) (*Link, error) {
+	return l.FixContext(context.Background(), warnings...)
+}
+
+func (l *Link) FixContext(ctx context.Context, warnings ...Warning) (*Link, error) {
+	err := l.bucket.store.change(ctx, func() error {
+		l.validate()
+
+		u := *l.url
+		for _, w := range warnings {
+			switch w.category {
+			case MismatchRecordWarning:
+				// the record is rewritten when the link is pushed
+			case NoUUIDWarning, MismatchUUIDWarning:
+				q := u.Query()
+				q.Set("pindbuuid", l.uuid.String())
+				u.RawQuery = q.Encode()
+			case MultiplePinDBGroupTagWarning:
+				l.collapseGroups()
+			case UnrelatedPinDBGroupTagWarning, UnrelatedPinDBStoreTagWarning, UnrelatedPinDBBucketTagWarning:
+				l.tags.remove(l.flagged(w)...)
+			default:
+				return fmt.Errorf("unknown warning: %s", w.category)
+			}
+		}
+
+		if u.String() != l.url.String() {
+			l.setURL(&u)
+		} else {
+			l.options(true)
+			l.bucket.store.enqueue(newOperation(ReplaceOperation, l))
+		}
+
+		l.validate()
+		return nil
+	})
+	return l, err
+}
+
+// flagged returns the tags a warning applies to.
+func (l *Link) flagged(w Warning) Tags {
+	if strings.TrimSpace(w.tag.String()) != "" {
+		return Tags{w.tag}
+	}
+
+	t := newTags()
+	for _, v := range l.warnings {
+		if v.category == w.category {
+			t = append(t, v.tag)
+		}
+	}
+	return t
+}
+
+// collapseGroups keeps a single group tag for the bucket, preferring the
+// group the link is already in.
+func (l *Link) collapseGroups() {
+	rgg := regexp.MustCompile(fmt.Sprintf(`^/pindb/bucket:\"%s\"/group:\"([0-9a-f\-]+)\"$`, l.bucket.uuid.String()))
+	gt := newTags()
+	for _, t := range l.tags {
+		if rgg.MatchString(t.String()) {
+			gt = append(gt, t)
+		}
+	}
+	if len(gt) == 0 {
+		return
+	}
+
+	keep := gt[0]
+	if gt.has(l.group) {
+		keep = l.group
+	}
+
+	for _, t := range gt {
+		if !t.Is(keep) {
+			l.tags.remove(t)
+		}
+	}
+	l.group = keep
 }
 
 func (l *Link) JSON() LinkJSON {
+	l.bucket.store.mu.RLock()
+	defer l.bucket.store.mu.RUnlock()
+	return l.json()
+}
+
+func (l *Link) json() LinkJSON {
 	j := LinkJSON{}
 	j.Description = string(l.description)
 	j.Group = l.group.String()
@@ -250,6 +512,7 @@ func (l *Link) JSON() LinkJSON {
 	j.UUID = l.uuid.String()
 	j.Url = l.url.String()
 	j.Warnings = l.warnings.json()
+	j.Dirty = l.bucket.store.queue.has(l.uuid)
 	return j
 }
 
@@ -258,21 +521,13 @@ func (l *Link) record() []byte {
 		"L\u2063%s\u2063%s\u2063%s\u2063%s\u2063%s\u2063%s",
 		l.uuid.String(),
 		l.bucket.uuid.String(),
-		l.url.String(),
-		l.title,
-		l.group.String(),
+		escape(l.url.String()),
+		escape(l.title),
+		escape(l.group.String()),
 		l.tags.record()))
 }
 
 func newLink(bucket *Bucket, title string, url *url.URL, group Tag, tags ...Tag) (*Link, error) {
-	if strings.Contains(title, "\u2063") {
-		return nil, errors.New("title cannot contain invisible separator (U+2063)")
-	}
-
-	if strings.Contains(url.String(), "\u2063") {
-		return nil, errors.New("url cannot contain invisible separator (U+2063)")
-	}
-
 	_, err := group.Validate()
 	if err != nil {
 		return nil, err
@@ -296,7 +551,7 @@ func newLink(bucket *Bucket, title string, url *url.URL, group Tag, tags ...Tag)
 	}
 
 	l.description = l.record()
-	l.Validate()
+	l.validate()
 
 	return l, nil
 }
@@ -311,4 +566,5 @@ type LinkJSON struct {
 	Group       string       `json:"group,omitempty"`
 	Tags        []string     `json:"tags,omitempty"`
 	Warnings    WarningsJSON `json:"warnings,omitempty"`
+	Dirty       bool         `json:"dirty,omitempty"`
 }
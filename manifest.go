@@ -0,0 +1,218 @@
+package pindb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/tmstn/pinboard"
+)
+
+const manifestHeader = "PINDBMANIFEST:v1"
+
+var ManifestTag = NewTag("/pindb/manifest")
+
+// manifest is the store and bucket metadata published in the extended field
+// of a private sentinel post, so that it is not only kept in the local file.
+type manifest struct {
+	name    string
+	buckets map[uuid.UUID]string
+	groups  [][]string
+}
+
+func parseManifest(data []byte) (*manifest, error) {
+	f := string(data)
+	if !strings.HasPrefix(f, manifestHeader+"\n") {
+		return nil, errors.New("invalid pindb manifest")
+	}
+
+	m := &manifest{
+		buckets: map[uuid.UUID]string{},
+	}
+
+	for _, l := range strings.Split(strings.TrimPrefix(f, manifestHeader+"\n"), "\n") {
+		parts := strings.Split(l, "\u2063")
+		switch parts[0] {
+		case "SN":
+			if len(parts) != 2 {
+				return nil, errors.New("invalid manifest store record")
+			}
+			m.name = unescape(parts[1])
+		case "B":
+			if len(parts) != 3 {
+				return nil, errors.New("invalid manifest bucket record")
+			}
+
+			uid, err := uuid.Parse(parts[1])
+			if err != nil {
+				return nil, err
+			}
+			m.buckets[uid] = unescape(parts[2])
+		case "G":
+			if len(parts) != 5 {
+				return nil, errors.New("invalid manifest group record")
+			}
+			m.groups = append(m.groups, parts[1:])
+		}
+	}
+
+	return m, nil
+}
+
+func (s *Store) manifestURL() string {
+	return fmt.Sprintf("https://pindb.invalid/store/%s", s.uuid.String())
+}
+
+func (s *Store) manifestRecord() []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s\n", manifestHeader)
+	fmt.Fprintf(&b, "SN\u2063%s\n", escape(s.name))
+
+	buckets := s.buckets.list()
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].uuid.String() < buckets[j].uuid.String()
+	})
+
+	for _, v := range buckets {
+		fmt.Fprintf(&b, "B\u2063%s\u2063%s\n", v.uuid.String(), escape(v.name))
+	}
+
+	for _, v := range buckets {
+		b.Write(v.groups.writeBytes())
+	}
+	return b.Bytes()
+}
+
+func (s *Store) isManifest(post *pinboard.Post) bool {
+	return post.Href.String() == s.manifestURL()
+}
+
+// pullManifest reads the published manifest and adds the buckets it lists
+// that are not known locally. It returns the published record, empty when
+// there is none, and how many buckets were added. It is called with remote
+// held and mu not.
+func (s *Store) pullManifest(ctx context.Context, api Backend) (string, int, error) {
+	posts, err := api.Get(ctx, &pinboard.PostsGetOptions{
+		URL: s.manifestURL(),
+	})
+
+	if err != nil {
+		return "", 0, err
+	}
+
+	for _, post := range posts {
+		if s.isManifest(post) {
+			m, err := parseManifest(post.Extended)
+			if err != nil {
+				return "", 0, err
+			}
+
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			return string(post.Extended), s.reconcile(m), nil
+		}
+	}
+
+	return "", 0, nil
+}
+
+// reconcile adds the buckets and groups of m that are missing locally. Local
+// names win for those that are known on both sides.
+func (s *Store) reconcile(m *manifest) int {
+	added := 0
+	for uid, name := range m.buckets {
+		if s.buckets.has(uid) {
+			continue
+		}
+
+		b, err := newBucket(s, name)
+		if err != nil {
+			continue
+		}
+
+		b.uuid = uid
+		s.buckets.set(b)
+		added++
+	}
+
+	for _, parts := range m.groups {
+		g, err := parseGroup(s, parts)
+		if err != nil || g.bucket.groups.has(g.uuid) {
+			continue
+		}
+
+		g.bucket.groups.set(g)
+	}
+	return added
+}
+
+// publishManifest is called with remote held and mu not.
+func (s *Store) publishManifest(ctx context.Context, api Backend) error {
+	s.mu.RLock()
+	opts := &pinboard.PostsAddOptions{
+		URL:         s.manifestURL(),
+		Description: fmt.Sprintf("pindb store %s", s.name),
+		Extended:    s.manifestRecord(),
+		Tags:        []string{s.Tag().String(), ManifestTag.String()},
+		Replace:     true,
+		Shared:      false,
+		Toread:      false,
+	}
+	s.mu.RUnlock()
+
+	return api.Add(ctx, opts)
+}
+
+func (s *Store) Manifest() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.manifest
+}
+
+// SetManifest turns the published manifest on or off. Enabling it publishes
+// the manifest straight away, disabling it removes the sentinel post.
+func (s *Store) SetManifest(enabled bool) (*Store, error) {
+	return s.SetManifestContext(context.Background(), enabled)
+}
+
+func (s *Store) SetManifestContext(ctx context.Context, enabled bool) (*Store, error) {
+	s.remote.Lock()
+	defer s.remote.Unlock()
+
+	s.mu.RLock()
+	tx, published := s.tx, s.manifest
+	s.mu.RUnlock()
+
+	if tx != nil {
+		return s, ErrTransaction
+	}
+
+	api, err := s.api(ctx)
+	if err != nil {
+		return s, err
+	}
+
+	if enabled {
+		_, _, err = s.pullManifest(ctx, api)
+		if err != nil {
+			return s, err
+		}
+
+		err = s.publishManifest(ctx, api)
+	} else if published {
+		err = api.Delete(ctx, s.manifestURL())
+	}
+
+	if err != nil {
+		return s, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.manifest = enabled
+	return s, nil
+}
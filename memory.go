@@ -0,0 +1,269 @@
+package pindb
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tmstn/pinboard"
+)
+
+// MemoryBackend keeps posts in memory. It is meant for tests and for stores
+// that are never synchronised with a remote service.
+type MemoryBackend struct {
+	mu      sync.RWMutex
+	posts   map[string]*pinboard.Post
+	updated time.Time
+}
+
+func (m *MemoryBackend) Authenticate(ctx context.Context) error {
+	return ctx.Err()
+}
+
+func (m *MemoryBackend) Add(ctx context.Context, opts *pinboard.PostsAddOptions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	u, err := url.Parse(opts.URL)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, ok := m.posts[opts.URL]
+	if ok && !opts.Replace {
+		return errors.New("item already exists")
+	}
+
+	now := time.Now().UTC()
+	created := now
+	if ok {
+		created = existing.Time
+	} else if !opts.Dt.IsZero() {
+		created = opts.Dt
+	}
+
+	m.posts[opts.URL] = &pinboard.Post{
+		Href:        u,
+		Description: opts.Description,
+		Extended:    []byte(opts.Extended),
+		Tags:        append([]string{}, opts.Tags...),
+		Shared:      opts.Shared,
+		Toread:      opts.Toread,
+		Time:        created,
+	}
+	m.touch(now)
+	return nil
+}
+
+func (m *MemoryBackend) Delete(ctx context.Context, url string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.posts[url]; !ok {
+		return ErrNotFound
+	}
+
+	delete(m.posts, url)
+	m.touch(time.Now().UTC())
+	return nil
+}
+
+func (m *MemoryBackend) Get(ctx context.Context, opts *pinboard.PostsGetOptions) ([]*pinboard.Post, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if opts == nil || opts.URL == "" {
+		return nil, errors.New("memory backend only supports getting posts by url")
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	posts := []*pinboard.Post{}
+	p, ok := m.posts[opts.URL]
+	if ok && hasAllTags(p, opts.Tag) {
+		posts = append(posts, copyPost(p))
+	}
+	return posts, nil
+}
+
+func (m *MemoryBackend) All(ctx context.Context, opts *pinboard.PostsAllOptions) ([]*pinboard.Post, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if opts == nil {
+		opts = &pinboard.PostsAllOptions{}
+	}
+
+	posts := []*pinboard.Post{}
+	for _, p := range m.posts {
+		if !hasAllTags(p, opts.Tag) {
+			continue
+		}
+		if !opts.Fromdt.IsZero() && p.Time.Before(opts.Fromdt) {
+			continue
+		}
+		if !opts.Todt.IsZero() && p.Time.After(opts.Todt) {
+			continue
+		}
+		posts = append(posts, copyPost(p))
+	}
+
+	sort.Slice(posts, func(i, j int) bool {
+		return posts[i].Time.After(posts[j].Time)
+	})
+
+	if opts.Start > 0 {
+		if opts.Start > len(posts) {
+			opts.Start = len(posts)
+		}
+		posts = posts[opts.Start:]
+	}
+
+	if opts.Results > 0 && opts.Results < len(posts) {
+		posts = posts[:opts.Results]
+	}
+
+	return posts, nil
+}
+
+func (m *MemoryBackend) Recent(ctx context.Context, opts *pinboard.PostsRecentOptions) ([]*pinboard.Post, error) {
+	if opts == nil {
+		opts = &pinboard.PostsRecentOptions{}
+	}
+
+	count := opts.Count
+	if count <= 0 {
+		count = 15
+	}
+
+	return m.All(ctx, &pinboard.PostsAllOptions{
+		Tag:     opts.Tag,
+		Results: count,
+	})
+}
+
+func (m *MemoryBackend) Dates(ctx context.Context, opts *pinboard.PostsDatesOptions) (map[string]int, error) {
+	if opts == nil {
+		opts = &pinboard.PostsDatesOptions{}
+	}
+
+	posts, err := m.All(ctx, &pinboard.PostsAllOptions{
+		Tag: opts.Tag,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	dates := map[string]int{}
+	for _, p := range posts {
+		dates[p.Time.Format("2006-01-02")]++
+	}
+	return dates, nil
+}
+
+func (m *MemoryBackend) Update(ctx context.Context) (time.Time, error) {
+	if err := ctx.Err(); err != nil {
+		return time.Time{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.updated, nil
+}
+
+func (m *MemoryBackend) Tags(ctx context.Context) (map[string]int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	tags := map[string]int{}
+	for _, p := range m.posts {
+		for _, t := range p.Tags {
+			tags[t]++
+		}
+	}
+	return tags, nil
+}
+
+func (m *MemoryBackend) DeleteTag(ctx context.Context, tag string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, p := range m.posts {
+		tags := []string{}
+		for _, t := range p.Tags {
+			if t != tag {
+				tags = append(tags, t)
+			}
+		}
+		p.Tags = tags
+	}
+	m.touch(time.Now().UTC())
+	return nil
+}
+
+// touch records a change at t, which a new post shares with its creation
+// time as on Pinboard.
+func (m *MemoryBackend) touch(t time.Time) {
+	if !t.After(m.updated) {
+		t = m.updated.Add(time.Nanosecond)
+	}
+	m.updated = t
+}
+
+func hasAllTags(post *pinboard.Post, tags []string) bool {
+	for _, want := range tags {
+		found := false
+		for _, t := range post.Tags {
+			if strings.EqualFold(t, want) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func copyPost(p *pinboard.Post) *pinboard.Post {
+	c := *p
+	u := *p.Href
+	c.Href = &u
+	c.Extended = append([]byte{}, p.Extended...)
+	c.Tags = append([]string{}, p.Tags...)
+	return &c
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		posts: map[string]*pinboard.Post{},
+	}
+}
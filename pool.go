@@ -0,0 +1,242 @@
+package pindb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// DefaultWorkers is how many stores or buckets RefreshAll refreshes at once
+// unless told otherwise.
+const DefaultWorkers = 4
+
+// RefreshOptions controls RefreshAll.
+type RefreshOptions struct {
+	// Buckets limits the refresh to these buckets, which may belong to any
+	// loaded store. Every store is refreshed in full when it is empty.
+	Buckets []uuid.UUID
+	// Workers is the most stores or buckets refreshed at once.
+	Workers int
+	Force   bool
+}
+
+// RefreshAllResult holds what RefreshAll changed in each store and the
+// errors of the stores it could not refresh.
+type RefreshAllResult struct {
+	mu      sync.Mutex
+	results map[uuid.UUID]*RefreshResult
+	errors  map[uuid.UUID]error
+}
+
+// Results lists the changes by store uuid, including stores that failed
+// part way.
+func (r *RefreshAllResult) Results() []*RefreshResult {
+	results := []*RefreshResult{}
+	for _, v := range r.results {
+		results = append(results, v)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].store.String() < results[j].store.String()
+	})
+	return results
+}
+
+func (r *RefreshAllResult) Result(store uuid.UUID) (*RefreshResult, error) {
+	v, ok := r.results[store]
+	if !ok {
+		return nil, errors.New("store was not refreshed")
+	}
+	return v, r.errors[store]
+}
+
+func (r *RefreshAllResult) Errors() map[uuid.UUID]error {
+	errs := map[uuid.UUID]error{}
+	for k, v := range r.errors {
+		errs[k] = v
+	}
+	return errs
+}
+
+func (r *RefreshAllResult) add(store *Store, result *RefreshResult, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	v, ok := r.results[store.uuid]
+	if !ok {
+		v = newRefreshResult(store)
+		r.results[store.uuid] = v
+	}
+
+	if result != nil {
+		for _, c := range result.buckets {
+			v.add(c)
+		}
+	}
+
+	if err != nil {
+		r.errors[store.uuid] = errors.Join(r.errors[store.uuid], err)
+	}
+}
+
+// err joins the errors of every store, naming the store of each.
+func (r *RefreshAllResult) err(stores []*Store) error {
+	errs := []error{}
+	for _, s := range stores {
+		if err, ok := r.errors[s.uuid]; ok {
+			errs = append(errs, fmt.Errorf("store %s: %w", s.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (r *RefreshAllResult) JSON() RefreshAllResultJSON {
+	j := RefreshAllResultJSON{}
+	j.Stores = []RefreshResultJSON{}
+	for _, v := range r.Results() {
+		j.Stores = append(j.Stores, v.JSON())
+	}
+	j.Errors = map[string]string{}
+	for k, v := range r.errors {
+		j.Errors[k.String()] = v.Error()
+	}
+	return j
+}
+
+func newRefreshAllResult() *RefreshAllResult {
+	return &RefreshAllResult{
+		results: map[uuid.UUID]*RefreshResult{},
+		errors:  map[uuid.UUID]error{},
+	}
+}
+
+// refreshJob is a store, or one of its buckets, for a worker to refresh.
+type refreshJob struct {
+	store  *Store
+	bucket *Bucket
+}
+
+// RefreshAll refreshes every loaded store, or only the buckets in opts,
+// through a pool of workers. Stores of the same account ask for the time of
+// the last change to their posts once and share the rate limit of the
+// account. A store that fails does not stop the others; the returned error
+// joins the errors of every store that failed, which the result also holds
+// by store.
+func (c *Client) RefreshAll(ctx context.Context, opts *RefreshOptions) (*RefreshAllResult, error) {
+	if opts == nil {
+		opts = &RefreshOptions{}
+	}
+
+	stores := c.Stores()
+	jobs, err := refreshJobs(stores, opts.Buckets)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, a := range c.sharedAccounts(jobs) {
+		a.share()
+		defer a.unshare()
+	}
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+
+	r := newRefreshAllResult()
+	queue := make(chan refreshJob)
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				if err := ctx.Err(); err != nil {
+					r.add(job.store, nil, err)
+					continue
+				}
+
+				var result *RefreshResult
+				var err error
+				if job.bucket != nil {
+					result, err = job.bucket.RefreshContext(ctx, opts.Force)
+				} else {
+					result, err = job.store.RefreshContext(ctx, opts.Force)
+				}
+				r.add(job.store, result, err)
+			}
+		}()
+	}
+
+	for _, job := range jobs {
+		queue <- job
+	}
+	close(queue)
+	wg.Wait()
+
+	return r, r.err(stores)
+}
+
+// refreshJobs makes a job of each store, or of each of the buckets when
+// there are any.
+func refreshJobs(stores []*Store, buckets []uuid.UUID) ([]refreshJob, error) {
+	jobs := []refreshJob{}
+	if len(buckets) == 0 {
+		for _, s := range stores {
+			jobs = append(jobs, refreshJob{store: s})
+		}
+		return jobs, nil
+	}
+
+	seen := map[uuid.UUID]bool{}
+	for _, id := range buckets {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		found := false
+		for _, s := range stores {
+			s.mu.RLock()
+			b, err := s.buckets.get(id)
+			s.mu.RUnlock()
+
+			if err == nil {
+				jobs = append(jobs, refreshJob{store: s, bucket: b})
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("bucket does not exist: %s", id.String())
+		}
+	}
+	return jobs, nil
+}
+
+// sharedAccounts returns the accounts of the stores in jobs.
+func (c *Client) sharedAccounts(jobs []refreshJob) []*account {
+	seen := map[*account]bool{}
+	accounts := []*account{}
+	for _, job := range jobs {
+		job.store.mu.RLock()
+		a := c.account(job.store.user.token)
+		job.store.mu.RUnlock()
+
+		if !seen[a] {
+			seen[a] = true
+			accounts = append(accounts, a)
+		}
+	}
+	return accounts
+}
+
+type RefreshAllResultJSON struct {
+	Stores []RefreshResultJSON `json:"stores"`
+	Errors map[string]string   `json:"errors,omitempty"`
+}
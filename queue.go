@@ -0,0 +1,417 @@
+package pindb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/tmstn/pinboard"
+)
+
+type operations []*Operation
+
+// add queues op and returns the operation that now carries it: op itself,
+// the add or replace already queued for its link, or nil when a delete
+// cancels changes that never reached the backend.
+func (o *operations) add(op *Operation) *Operation {
+	switch op.kind {
+	case AddOperation, ReplaceOperation:
+		for _, v := range *o {
+			if v.link == op.link && (v.kind == AddOperation || v.kind == ReplaceOperation) {
+				return v
+			}
+		}
+	case DeleteOperation:
+		unpushed := o.unpushed(op.link)
+		n := operations{}
+		for _, v := range *o {
+			if v.link == op.link && v.url == op.url && (v.kind == AddOperation || v.kind == ReplaceOperation) {
+				continue
+			}
+			n = append(n, v)
+		}
+		*o = n
+		if unpushed {
+			return nil
+		}
+	}
+	*o = append(*o, op)
+	return op
+}
+
+func (o *operations) remove(op *Operation) {
+	n := operations{}
+	for _, v := range *o {
+		if v != op {
+			n = append(n, v)
+		}
+	}
+	*o = n
+}
+
+// unpushed reports whether the current url of a link has never reached the
+// backend: either the link itself is queued for adding, or it was moved and
+// the replace at the new url is queued behind the delete of the old one.
+func (o *operations) unpushed(link uuid.UUID) bool {
+	replaced, deleted := false, false
+	for _, v := range *o {
+		if v.link != link {
+			continue
+		}
+		switch v.kind {
+		case AddOperation:
+			return true
+		case ReplaceOperation:
+			replaced = true
+		case DeleteOperation:
+			deleted = true
+		}
+	}
+	return replaced && deleted
+}
+
+// retarget points the queued adds and replaces of a link at its new url.
+func (o *operations) retarget(link uuid.UUID, url string) {
+	for _, v := range *o {
+		if v.link == link && (v.kind == AddOperation || v.kind == ReplaceOperation) {
+			v.url = url
+		}
+	}
+}
+
+func (o *operations) has(link uuid.UUID) bool {
+	for _, v := range *o {
+		if v.link == link {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *operations) list() []*Operation {
+	ops := []*Operation{}
+	return append(ops, *o...)
+}
+
+func (o *operations) writeBytes() []byte {
+	b := []byte{}
+	for _, v := range *o {
+		b = append(b, v.record()...)
+		b = append(b, '\n')
+	}
+	return b
+}
+
+func (o *operations) json() OperationsJSON {
+	j := OperationsJSON{}
+	for _, v := range *o {
+		j = append(j, v.JSON())
+	}
+	return j
+}
+
+func newOperations() *operations {
+	return &operations{}
+}
+
+type OperationKind string
+
+func (k OperationKind) String() string {
+	return string(k)
+}
+
+const (
+	AddOperation     OperationKind = "add"
+	ReplaceOperation OperationKind = "replace"
+	DeleteOperation  OperationKind = "delete"
+)
+
+// Operation is a change to a link that has been applied locally but not yet
+// pushed to the backend.
+type Operation struct {
+	uuid   uuid.UUID
+	kind   OperationKind
+	bucket uuid.UUID
+	link   uuid.UUID
+	url    string
+}
+
+func (o *Operation) UUID() uuid.UUID {
+	return o.uuid
+}
+
+func (o *Operation) Kind() OperationKind {
+	return o.kind
+}
+
+func (o *Operation) Bucket() uuid.UUID {
+	return o.bucket
+}
+
+func (o *Operation) Link() uuid.UUID {
+	return o.link
+}
+
+func (o *Operation) URL() string {
+	return o.url
+}
+
+func (o *Operation) JSON() OperationJSON {
+	j := OperationJSON{}
+	j.UUID = o.uuid.String()
+	j.Kind = o.kind.String()
+	j.Bucket = o.bucket.String()
+	j.Link = o.link.String()
+	j.Url = o.url
+	return j
+}
+
+func (o *Operation) record() []byte {
+	return []byte(fmt.Sprintf(
+		"Q\u2063%s\u2063%s\u2063%s\u2063%s\u2063%s",
+		o.uuid.String(),
+		o.kind.String(),
+		o.bucket.String(),
+		o.link.String(),
+		escape(o.url)))
+}
+
+func newOperation(kind OperationKind, link *Link) *Operation {
+	return &Operation{
+		uuid:   uuid.New(),
+		kind:   kind,
+		bucket: link.bucket.uuid,
+		link:   link.uuid,
+		url:    link.url.String(),
+	}
+}
+
+func parseOperation(parts []string) (*Operation, error) {
+	if len(parts) != 5 {
+		return nil, errors.New("invalid queue record")
+	}
+
+	uid, err := uuid.Parse(parts[0])
+	if err != nil {
+		return nil, err
+	}
+
+	kind := OperationKind(parts[1])
+	switch kind {
+	case AddOperation, ReplaceOperation, DeleteOperation:
+	default:
+		return nil, fmt.Errorf("unknown queue operation: %s", parts[1])
+	}
+
+	buid, err := uuid.Parse(parts[2])
+	if err != nil {
+		return nil, err
+	}
+
+	luid, err := uuid.Parse(parts[3])
+	if err != nil {
+		return nil, err
+	}
+
+	return &Operation{
+		uuid:   uid,
+		kind:   kind,
+		bucket: buid,
+		link:   luid,
+		url:    unescape(parts[4]),
+	}, nil
+}
+
+// ErrQueued is wrapped by the error of a change that was made to the store
+// but could not be pushed. The change stays queued for Push.
+var ErrQueued = errors.New("change is queued but could not be pushed")
+
+// enqueue records op. In a transaction it is staged for the commit,
+// otherwise unless offline the changes queued for its link are pushed once
+// the change that queued it is done.
+func (s *Store) enqueue(op *Operation) {
+	queued := s.queue.add(op)
+	if s.tx != nil {
+		s.tx.stage(queued)
+		return
+	}
+
+	if s.client != nil && s.client.offline {
+		return
+	}
+
+	for _, v := range s.touched {
+		if v == op.link {
+			return
+		}
+	}
+	s.touched = append(s.touched, op.link)
+}
+
+// change runs f with the write lock held, then pushes the changes f queued
+// with only remote held. When a push fails the change is kept and stays
+// queued, and the error wraps ErrQueued.
+func (s *Store) change(ctx context.Context, f func() error) error {
+	s.remote.Lock()
+	defer s.remote.Unlock()
+
+	s.mu.Lock()
+	err := f()
+	touched := s.touched
+	s.touched = nil
+	s.mu.Unlock()
+
+	errs := []error{}
+	for _, link := range touched {
+		perr := s.pushLink(ctx, link)
+		if perr != nil {
+			errs = append(errs, perr)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.Join(err, fmt.Errorf("%w: %w", ErrQueued, errors.Join(errs...)))
+	}
+	return err
+}
+
+// pushLink pushes the queued operations of link in order until one fails.
+func (s *Store) pushLink(ctx context.Context, link uuid.UUID) error {
+	s.mu.RLock()
+	ops := s.queue.list()
+	s.mu.RUnlock()
+
+	for _, op := range ops {
+		if op.link != link {
+			continue
+		}
+
+		err := s.replay(ctx, op)
+		if err != nil {
+			return fmt.Errorf("%s %s: %w", op.kind, op.url, err)
+		}
+	}
+	return nil
+}
+
+// replay pushes op and takes it off the queue. It is called with remote
+// held and mu not, which it only takes to read the link and to update the
+// queue.
+func (s *Store) replay(ctx context.Context, op *Operation) error {
+	api, err := s.api(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	opts := s.post(op)
+	s.mu.Unlock()
+
+	if op.kind == DeleteOperation {
+		// a post that is already gone needs no deleting
+		err = api.Delete(ctx, op.url)
+		if errors.Is(err, ErrNotFound) {
+			err = nil
+		}
+	} else if opts != nil {
+		err = api.Add(ctx, opts)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queue.remove(op)
+	return nil
+}
+
+// post returns the post an add or replace sends, nil for deletes and for
+// links that no longer exist.
+func (s *Store) post(op *Operation) *pinboard.PostsAddOptions {
+	if op.kind == DeleteOperation {
+		return nil
+	}
+
+	b, err := s.buckets.get(op.bucket)
+	if err != nil {
+		return nil
+	}
+
+	l, err := b.links.get(op.link)
+	if err != nil {
+		return nil
+	}
+
+	// an add that reached the backend but failed on the way back is pushed
+	// again, and the pindbuuid in its url keeps it from replacing another post
+	return l.options(true)
+}
+
+// Pending lists copies of the queued operations in the order they will be
+// pushed.
+func (s *Store) Pending() []*Operation {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ops := []*Operation{}
+	for _, op := range s.queue.list() {
+		c := *op
+		ops = append(ops, &c)
+	}
+	return ops
+}
+
+// Push replays the queue against the backend. Operations that fail are kept
+// for the next push, along with the later operations of the same link, and
+// their errors are returned together.
+func (s *Store) Push() (*Store, error) {
+	return s.PushContext(context.Background())
+}
+
+// PushContext is Push bounded by ctx. Once ctx is done the operations not
+// yet pushed stay queued.
+func (s *Store) PushContext(ctx context.Context) (*Store, error) {
+	s.remote.Lock()
+	defer s.remote.Unlock()
+
+	s.mu.RLock()
+	tx := s.tx
+	ops := s.queue.list()
+	s.mu.RUnlock()
+
+	if tx != nil {
+		return s, ErrTransaction
+	}
+
+	errs := []error{}
+	failed := map[uuid.UUID]bool{}
+	for _, op := range ops {
+		// a delete of the old url of a moved link must wait for its new url
+		if failed[op.link] {
+			continue
+		}
+
+		err := s.replay(ctx, op)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s %s: %w", op.kind, op.url, err))
+			if errors.Is(err, ErrOffline) || ctx.Err() != nil {
+				break
+			}
+			failed[op.link] = true
+		}
+	}
+	return s, errors.Join(errs...)
+}
+
+type OperationsJSON []OperationJSON
+
+type OperationJSON struct {
+	UUID   string `json:"uuid,omitempty"`
+	Kind   string `json:"kind,omitempty"`
+	Bucket string `json:"bucket,omitempty"`
+	Link   string `json:"link,omitempty"`
+	Url    string `json:"url,omitempty"`
+}
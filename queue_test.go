@@ -0,0 +1,181 @@
+package pindb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/tmstn/pinboard"
+)
+
+// failingBackend fails every call to Add while fail is set.
+type failingBackend struct {
+	*MemoryBackend
+	mu   sync.Mutex
+	fail bool
+}
+
+func (f *failingBackend) setFail(fail bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fail = fail
+}
+
+func (f *failingBackend) Add(ctx context.Context, opts *pinboard.PostsAddOptions) error {
+	f.mu.Lock()
+	fail := f.fail
+	f.mu.Unlock()
+
+	if fail {
+		return errors.New("error: http 400")
+	}
+	return f.MemoryBackend.Add(ctx, opts)
+}
+
+func TestQueueKeepsFailedChanges(t *testing.T) {
+	m := &failingBackend{MemoryBackend: NewMemoryBackend(), fail: true}
+	s, b := newTestStore(t, m)
+
+	l, err := b.Add("link", mustParse(t, "https://example.com"), nil)
+	if !errors.Is(err, ErrQueued) {
+		t.Fatalf("got %v adding while the backend fails, want ErrQueued", err)
+	}
+
+	if !l.Dirty() || len(s.Pending()) != 1 || len(m.posts) != 0 {
+		t.Fatalf("got dirty %t, %d pending and %d posts, want the add queued", l.Dirty(), len(s.Pending()), len(m.posts))
+	}
+
+	// the queue is kept in the store file
+	r, err := New(WithBackend(m)).ReadStream(bytes.NewReader(s.WriteBytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p := r.Pending(); len(p) != 1 || p[0].Kind() != AddOperation || p[0].Link() != l.UUID() {
+		t.Fatalf("got %v pending after reading the store, want the add", p)
+	}
+
+	if _, err := s.Push(); err == nil {
+		t.Fatal("push succeeded while the backend fails")
+	}
+	if n := len(s.Pending()); n != 1 {
+		t.Fatalf("got %d pending after a failed push, want 1", n)
+	}
+
+	m.setFail(false)
+	if _, err := s.Push(); err != nil {
+		t.Fatal(err)
+	}
+
+	if l.Dirty() || len(s.Pending()) != 0 {
+		t.Fatalf("got dirty %t and %d pending after push, want none", l.Dirty(), len(s.Pending()))
+	}
+	if _, ok := m.posts[l.URL(true).String()]; !ok {
+		t.Fatal("the link was not pushed")
+	}
+}
+
+func TestQueueHoldsBackLaterOperationsOfALink(t *testing.T) {
+	m := &failingBackend{MemoryBackend: NewMemoryBackend()}
+	s, b := newTestStore(t, m)
+
+	l, err := b.Add("link", mustParse(t, "https://example.com/old"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := l.URL(true).String()
+
+	m.setFail(true)
+	if _, err := l.SetURL(mustParse(t, "https://example.com/new")); !errors.Is(err, ErrQueued) {
+		t.Fatalf("got %v moving while the backend fails, want ErrQueued", err)
+	}
+
+	if _, err := s.Push(); err == nil {
+		t.Fatal("push succeeded while the backend fails")
+	}
+
+	// the old post stays until the link is at its new url
+	if _, ok := m.posts[old]; !ok {
+		t.Fatal("the old url was deleted before the new one was added")
+	}
+	if n := len(s.Pending()); n != 2 {
+		t.Fatalf("got %d pending, want the add and the delete", n)
+	}
+
+	m.setFail(false)
+	if _, err := s.Push(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := m.posts[old]; ok {
+		t.Error("the old url was not deleted")
+	}
+	if _, ok := m.posts[l.URL(true).String()]; !ok {
+		t.Error("the new url was not added")
+	}
+	if n := len(s.Pending()); n != 0 {
+		t.Errorf("got %d pending, want 0", n)
+	}
+}
+
+func TestQueueDropsDeletesOfMissingPosts(t *testing.T) {
+	m := NewMemoryBackend()
+	s, b := newTestStore(t, m)
+
+	l, err := b.Add("link", mustParse(t, "https://example.com"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Delete(context.Background(), l.URL(true).String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := l.Remove(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(s.Pending()); n != 0 {
+		t.Fatalf("got %d pending, want the delete of the missing post dropped", n)
+	}
+}
+
+// lostBackend applies adds but reports the first one failed, as when the
+// answer to a request is lost.
+type lostBackend struct {
+	*MemoryBackend
+	lost atomic.Bool
+}
+
+func (l *lostBackend) Add(ctx context.Context, opts *pinboard.PostsAddOptions) error {
+	err := l.MemoryBackend.Add(ctx, opts)
+	if err == nil && l.lost.CompareAndSwap(false, true) {
+		return errors.New("connection reset by peer")
+	}
+	return err
+}
+
+func TestQueuePushesAddsThatReachedTheBackend(t *testing.T) {
+	m := &lostBackend{MemoryBackend: NewMemoryBackend()}
+	s, b := newTestStore(t, m)
+
+	l, err := b.Add("link", mustParse(t, "https://example.com"), nil)
+	if !errors.Is(err, ErrQueued) {
+		t.Fatalf("got %v, want ErrQueued", err)
+	}
+
+	if _, ok := m.posts[l.URL(true).String()]; !ok {
+		t.Fatal("the add did not reach the backend")
+	}
+
+	if _, err := s.Push(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(s.Pending()); n != 0 {
+		t.Fatalf("got %d pending, want the add pushed again", n)
+	}
+}
@@ -0,0 +1,234 @@
+package pindb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+type RecoverReport struct {
+	posts   int
+	buckets int
+	links   int
+	corrupt []*CorruptPost
+}
+
+func (r *RecoverReport) Posts() int {
+	return r.posts
+}
+
+func (r *RecoverReport) Buckets() int {
+	return r.buckets
+}
+
+func (r *RecoverReport) Links() int {
+	return r.links
+}
+
+func (r *RecoverReport) Corrupt() []*CorruptPost {
+	return r.corrupt
+}
+
+func (r *RecoverReport) JSON() RecoverReportJSON {
+	j := RecoverReportJSON{}
+	j.Posts = r.posts
+	j.Buckets = r.buckets
+	j.Links = r.links
+	j.Corrupt = []CorruptPostJSON{}
+	for _, c := range r.corrupt {
+		j.Corrupt = append(j.Corrupt, c.JSON())
+	}
+	return j
+}
+
+// CorruptPost is a post tagged for the store whose extended field does not
+// hold a valid link record.
+type CorruptPost struct {
+	url    string
+	title  string
+	reason string
+}
+
+func (c *CorruptPost) URL() string {
+	return c.url
+}
+
+func (c *CorruptPost) Title() string {
+	return c.title
+}
+
+func (c *CorruptPost) Reason() string {
+	return c.reason
+}
+
+func (c *CorruptPost) JSON() CorruptPostJSON {
+	j := CorruptPostJSON{}
+	j.Url = c.url
+	j.Title = c.title
+	j.Reason = c.reason
+	return j
+}
+
+// linkRecordBucket returns the bucket named by a link record as written to
+// the extended field of a post.
+func linkRecordBucket(record string) (uuid.UUID, error) {
+	parts := strings.Split(record, "\u2063")
+	if len(parts) != 7 || parts[0] != "L" {
+		return uuid.Nil, errors.New("invalid link record")
+	}
+
+	if _, err := uuid.Parse(parts[1]); err != nil {
+		return uuid.Nil, fmt.Errorf("invalid link uuid: %s", err.Error())
+	}
+
+	buid, err := uuid.Parse(parts[2])
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("invalid bucket uuid: %s", err.Error())
+	}
+
+	return buid, nil
+}
+
+func placeholderName(kind string, uid uuid.UUID) string {
+	return fmt.Sprintf("recovered %s %s", kind, strings.Split(uid.String(), "-")[0])
+}
+
+// Recover rebuilds a store from the tags and posts held by the backend. Names
+// come from the published manifest when the store has one, otherwise the
+// store and its buckets get placeholder names.
+func (c *Client) Recover(token string, store uuid.UUID) (*Store, *RecoverReport, error) {
+	return c.RecoverContext(context.Background(), token, store)
+}
+
+func (c *Client) RecoverContext(ctx context.Context, token string, store uuid.UUID) (*Store, *RecoverReport, error) {
+	s, report, err := c.recover(ctx, token, store)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the store is only held once nothing else uses its context
+	c.add(s)
+	return s, report, nil
+}
+
+func (c *Client) recover(ctx context.Context, token string, store uuid.UUID) (*Store, *RecoverReport, error) {
+	s, err := newStore(ctx, c, token, placeholderName("store", store))
+	if err != nil {
+		return nil, nil, err
+	}
+	s.uuid = store
+
+	api, err := s.api(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tags, err := api.Tags(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	found := map[uuid.UUID]bool{}
+	rg := regexp.MustCompile(fmt.Sprintf(`^/pindb/store:\"%s\"/bucket:\"([0-9a-f\-]+)\"$`, store.String()))
+	for t := range tags {
+		if rg.MatchString(t) {
+			uid, err := uuid.Parse(rg.FindStringSubmatch(t)[1])
+			if err == nil {
+				found[uid] = true
+			}
+		}
+	}
+
+	f, err := fetchTag(ctx, api, s.Tag(), nil, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	posts := f.posts
+
+	report := &RecoverReport{
+		posts:   len(posts),
+		corrupt: []*CorruptPost{},
+	}
+
+	var m *manifest
+	for _, post := range posts {
+		if s.isManifest(post) {
+			m, err = parseManifest(post.Extended)
+			if err != nil {
+				report.corrupt = append(report.corrupt, &CorruptPost{
+					url:    post.Href.String(),
+					title:  post.Description,
+					reason: err.Error(),
+				})
+			}
+			continue
+		}
+
+		uid, err := linkRecordBucket(string(post.Extended))
+		if err != nil {
+			report.corrupt = append(report.corrupt, &CorruptPost{
+				url:    post.Href.String(),
+				title:  post.Description,
+				reason: err.Error(),
+			})
+			continue
+		}
+		found[uid] = true
+	}
+
+	if m != nil {
+		s.name = m.name
+		s.manifest = true
+		s.reconcile(m)
+	}
+
+	for uid := range found {
+		if s.buckets.has(uid) {
+			continue
+		}
+
+		b, err := newBucket(s, placeholderName("bucket", uid))
+		if err != nil {
+			return nil, nil, err
+		}
+		b.uuid = uid
+		s.buckets.set(b)
+	}
+
+	fresh := map[uuid.UUID]*links{}
+	for _, bucket := range *s.buckets {
+		fresh[bucket.uuid] = newLinks()
+	}
+
+	untracked, err := s.merge(fresh, posts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, bucket := range *s.buckets {
+		bucket.apply(fresh[bucket.uuid], f.update)
+		report.links += len(*bucket.links)
+	}
+
+	report.buckets = len(*s.buckets)
+	s.untracked = untracked
+	s.refreshedAt = &f.update
+	return s, report, nil
+}
+
+type RecoverReportJSON struct {
+	Posts   int               `json:"posts"`
+	Buckets int               `json:"buckets"`
+	Links   int               `json:"links"`
+	Corrupt []CorruptPostJSON `json:"corrupt"`
+}
+
+type CorruptPostJSON struct {
+	Url    string `json:"url,omitempty"`
+	Title  string `json:"title,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
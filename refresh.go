@@ -0,0 +1,315 @@
+package pindb
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tmstn/pinboard"
+)
+
+func linkFromPost(bucket *Bucket, post *pinboard.Post) (*Link, error) {
+	link, err := newLink(
+		bucket,
+		post.Description,
+		post.Href,
+		NewTag(""),
+		newTags().populate(post.Tags...)...,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// without a usable pindbuuid the uuid is derived from the url so that
+	// repeated refreshes agree on it; the link is left with a warning for
+	// Fix to repair
+	puid, err := uuid.Parse(link.url.Query().Get("pindbuuid"))
+	if err == nil {
+		link.uuid = puid
+	} else {
+		link.uuid = uuid.NewSHA1(uuid.NameSpaceURL, []byte(post.Href.String()))
+	}
+
+	rg := regexp.MustCompile(fmt.Sprintf(`^/pindb/bucket:\"%s\"/group:\"([0-9a-f\-]+)\"$`, link.bucket.uuid.String()))
+	for _, t := range link.tags {
+		if rg.MatchString(t.String()) {
+			link.group = t
+		}
+	}
+
+	link.description = []byte(post.Extended)
+	link.validate()
+	return link, nil
+}
+
+func (s *Store) bucketsForPost(post *pinboard.Post) []*Bucket {
+	buckets := []*Bucket{}
+	rg := regexp.MustCompile(fmt.Sprintf(`^/pindb/store:\"%s\"/bucket:\"([0-9a-f\-]+)\"$`, s.uuid.String()))
+	for _, tag := range post.Tags {
+		if rg.MatchString(tag) {
+			puid, err := uuid.Parse(rg.FindStringSubmatch(tag)[1])
+			if err == nil {
+				bucket, err := s.buckets.get(puid)
+				if err == nil {
+					buckets = append(buckets, bucket)
+				}
+			}
+		}
+	}
+	return buckets
+}
+
+// merge turns posts into links of their buckets and returns how many posts
+// did not belong to any known bucket.
+func (s *Store) merge(fresh map[uuid.UUID]*links, posts []*pinboard.Post) (int, error) {
+	untracked := 0
+	for _, post := range posts {
+		buckets := s.bucketsForPost(post)
+		if len(buckets) == 0 {
+			untracked++
+		}
+
+		for _, bucket := range buckets {
+			link, err := linkFromPost(bucket, post)
+			if err != nil {
+				return untracked, err
+			}
+
+			fresh[bucket.uuid].set(link)
+		}
+	}
+	return untracked, nil
+}
+
+// fetched holds the posts read from the backend for a refresh and the time
+// of the last change to the posts of the account before they were read.
+type fetched struct {
+	posts  []*pinboard.Post
+	update time.Time
+}
+
+// changed reports whether the posts of the account changed after since.
+func changed(ctx context.Context, api Backend, since *time.Time) (bool, error) {
+	if since == nil {
+		return true, nil
+	}
+
+	t, err := api.Update(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	return t.After(*since), nil
+}
+
+// fetchTag reads the posts tagged with tag, nil when the posts of the
+// account did not change after since. Pinboard keeps the creation time of a
+// post when it is edited, so posts/recent cannot tell an edit followed by a
+// new post from the new post alone; every post is read whenever anything
+// changed.
+func fetchTag(ctx context.Context, api Backend, tag Tag, since *time.Time, force bool) (*fetched, error) {
+	// the time of the last change is read first, so that a change made
+	// while the posts are read is seen by the next refresh
+	update, err := api.Update(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if !force && since != nil && !update.After(*since) {
+		return nil, nil
+	}
+
+	posts, err := api.All(ctx, &pinboard.PostsAllOptions{
+		Tag: []string{tag.String()},
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &fetched{posts: posts, update: update}, nil
+}
+
+// fetch reads the posts of the store from the backend, nil when nothing
+// changed since the last refresh. It is called with remote held and mu not.
+func (s *Store) fetch(ctx context.Context, api Backend, force bool) (*fetched, error) {
+	s.mu.RLock()
+	since := s.refreshedAt
+	s.mu.RUnlock()
+
+	return fetchTag(ctx, api, s.Tag(), since, force)
+}
+
+// fresh turns fetched posts into the links of every bucket and returns them
+// with the number of posts that belong to no known bucket.
+func (s *Store) fresh(f *fetched) (map[uuid.UUID]*links, int, error) {
+	fresh := map[uuid.UUID]*links{}
+	for _, bucket := range *s.buckets {
+		fresh[bucket.uuid] = newLinks()
+	}
+
+	untracked, err := s.merge(fresh, f.posts)
+	if err != nil {
+		return nil, 0, err
+	}
+	return fresh, untracked, nil
+}
+
+// refresh is called with remote held and mu not. The backend is called
+// without the write lock, which is only taken to apply what was fetched.
+func (s *Store) refresh(ctx context.Context, force, dryRun bool) (*RefreshResult, error) {
+	r := newRefreshResult(s)
+	api, err := s.api(ctx)
+	if err != nil {
+		return r, err
+	}
+
+	s.mu.RLock()
+	manifest := s.manifest
+	s.mu.RUnlock()
+
+	published := ""
+	if manifest && !dryRun {
+		record, added, err := s.pullManifest(ctx, api)
+		if err != nil {
+			return r, err
+		}
+
+		published = record
+		force = force || added > 0
+	}
+
+	f, err := s.fetch(ctx, api, force)
+	if err != nil {
+		return r, err
+	}
+
+	s.mu.Lock()
+	if f != nil {
+		err = s.update(r, f, dryRun)
+	}
+	publish := s.manifest && string(s.manifestRecord()) != published
+	s.mu.Unlock()
+
+	if err != nil || dryRun || !publish {
+		return r, err
+	}
+
+	err = s.publishManifest(ctx, api)
+	return r, err
+}
+
+// update records in r what f changes and, unless dryRun is set, applies it.
+func (s *Store) update(r *RefreshResult, f *fetched, dryRun bool) error {
+	fresh, untracked, err := s.fresh(f)
+	if err != nil {
+		return err
+	}
+
+	for _, bucket := range *s.buckets {
+		bucket.keepPending(fresh[bucket.uuid])
+	}
+
+	for _, bucket := range s.buckets.list() {
+		r.add(diffLinks(bucket, bucket.links, fresh[bucket.uuid]))
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	for _, bucket := range *s.buckets {
+		bucket.apply(fresh[bucket.uuid], f.update)
+	}
+
+	s.untracked = untracked
+	ut := f.update
+	s.refreshedAt = &ut
+	return nil
+}
+
+// fetch reads the posts of the bucket from the backend, nil when nothing
+// changed since the last refresh. It is called with remote held and mu not.
+func (b *Bucket) fetch(ctx context.Context, api Backend, force bool) (*fetched, error) {
+	b.store.mu.RLock()
+	since := b.refreshedAt
+	b.store.mu.RUnlock()
+
+	return fetchTag(ctx, api, b.Tag(), since, force)
+}
+
+func (b *Bucket) merge(fresh *links, posts []*pinboard.Post) error {
+	for _, post := range posts {
+		link, err := linkFromPost(b, post)
+		if err != nil {
+			return err
+		}
+
+		fresh.set(link)
+	}
+	return nil
+}
+
+func (b *Bucket) fresh(f *fetched) (*links, error) {
+	fresh := newLinks()
+	err := b.merge(fresh, f.posts)
+	if err != nil {
+		return nil, err
+	}
+	return fresh, nil
+}
+
+// refresh is called with remote held and mu not.
+func (b *Bucket) refresh(ctx context.Context, force, dryRun bool) (*RefreshResult, error) {
+	r := newRefreshResult(b.store)
+	api, err := b.store.api(ctx)
+	if err != nil {
+		return r, err
+	}
+
+	f, err := b.fetch(ctx, api, force)
+	if err != nil || f == nil {
+		return r, err
+	}
+
+	b.store.mu.Lock()
+	defer b.store.mu.Unlock()
+
+	fresh, err := b.fresh(f)
+	if err != nil {
+		return r, err
+	}
+
+	b.keepPending(fresh)
+	r.add(diffLinks(b, b.links, fresh))
+
+	if !dryRun {
+		b.apply(fresh, f.update)
+	}
+
+	return r, nil
+}
+
+// apply replaces the links of the bucket with fresh, read from the backend
+// as it was at update. Links that are already known are updated in place,
+// so a *Link held by a caller stays current.
+func (b *Bucket) apply(fresh *links, update time.Time) {
+	for id, l := range *fresh {
+		_, l.group = b.ensureGroup(l.group)
+		if old, err := b.links.get(id); err == nil && old != l {
+			old.title = l.title
+			old.description = l.description
+			old.url = l.url
+			old.group = l.group
+			old.tags = l.tags
+			old.warnings = l.warnings
+			(*fresh)[id] = old
+		}
+	}
+
+	b.links = fresh
+	b.refreshedAt = &update
+}
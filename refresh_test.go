@@ -0,0 +1,159 @@
+package pindb
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tmstn/pinboard"
+)
+
+// countingBackend counts the calls to All, which only a full refresh makes.
+type countingBackend struct {
+	*MemoryBackend
+	all atomic.Int32
+}
+
+func (c *countingBackend) All(ctx context.Context, opts *pinboard.PostsAllOptions) ([]*pinboard.Post, error) {
+	c.all.Add(1)
+	return c.MemoryBackend.All(ctx, opts)
+}
+
+// newRefreshedStore returns a store refreshed with one post of its bucket
+// that was created an hour ago, as posts made outside pindb are.
+func newRefreshedStore(t *testing.T) (*countingBackend, *Store, *Bucket) {
+	t.Helper()
+
+	m := &countingBackend{MemoryBackend: NewMemoryBackend()}
+	s, b := newTestStore(t, m)
+
+	err := m.Add(context.Background(), &pinboard.PostsAddOptions{
+		URL:         "https://example.com/old",
+		Description: "old",
+		Tags:        []string{s.Tag().String(), b.Tag().String()},
+		Dt:          time.Now().UTC().Add(-time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Refresh(true); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(b.Links()); n != 1 {
+		t.Fatalf("got %d links, want 1", n)
+	}
+	return m, s, b
+}
+
+func TestRefreshFetchesNewPosts(t *testing.T) {
+	m, s, b := newRefreshedStore(t)
+
+	err := m.Add(context.Background(), &pinboard.PostsAddOptions{
+		URL:         "https://example.com/new",
+		Description: "new",
+		Tags:        []string{s.Tag().String(), b.Tag().String()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := s.Refresh(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(b.Links()); n != 2 || r.Empty() {
+		t.Fatalf("got %d links, want the new post added", n)
+	}
+}
+
+func TestRefreshFetchesEditsFollowedByNewPosts(t *testing.T) {
+	m, s, b := newRefreshedStore(t)
+
+	// an edit keeps the time the post was created, so only the new post
+	// shows in posts/recent
+	err := m.Add(context.Background(), &pinboard.PostsAddOptions{
+		URL:         "https://example.com/old",
+		Description: "edited",
+		Tags:        []string{s.Tag().String(), b.Tag().String()},
+		Replace:     true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Add(context.Background(), &pinboard.PostsAddOptions{
+		URL:         "https://example.com/new",
+		Description: "new",
+		Tags:        []string{s.Tag().String(), b.Tag().String()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Refresh(false); err != nil {
+		t.Fatal(err)
+	}
+
+	titles := map[string]bool{}
+	for _, l := range b.Links() {
+		titles[l.Title()] = true
+	}
+	if len(titles) != 2 || !titles["edited"] || !titles["new"] {
+		t.Fatalf("got titles %v, want the edit and the new post", titles)
+	}
+}
+
+func TestRefreshKeepsBackendUpdateTime(t *testing.T) {
+	m, s, b := newRefreshedStore(t)
+
+	update, err := m.Update(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if at := s.RefreshedAt(); at == nil || !at.Equal(update) {
+		t.Errorf("got store refreshed at %v, want %v", at, update)
+	}
+
+	if _, err := b.Refresh(true); err != nil {
+		t.Fatal(err)
+	}
+	if at := b.RefreshedAt(); at == nil || !at.Equal(update) {
+		t.Errorf("got bucket refreshed at %v, want %v", at, update)
+	}
+}
+
+func TestRefreshFallsBackForRemovals(t *testing.T) {
+	m, s, b := newRefreshedStore(t)
+
+	err := m.Delete(context.Background(), "https://example.com/old")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := s.Refresh(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(b.Links()); n != 0 || r.Empty() {
+		t.Fatalf("got %d links, want the removed post gone", n)
+	}
+}
+
+func TestRefreshSkipsUnchangedAccounts(t *testing.T) {
+	m, s, _ := newRefreshedStore(t)
+	full := m.all.Load()
+
+	r, err := s.Refresh(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !r.Empty() || m.all.Load() != full {
+		t.Fatal("refreshed a store whose account has not changed")
+	}
+}
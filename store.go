@@ -1,18 +1,21 @@
 package pindb
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"io"
 	"net/url"
-	"os"
-	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/tmstn/pinboard"
 )
 
 type stores map[uuid.UUID]*Store
@@ -32,26 +35,44 @@ func (s *stores) has(uuid uuid.UUID) bool {
 }
 
 func (s *stores) set(store *Store) {
-	m := *s
-	m[store.uuid] = store
-	s = &m
+	(*s)[store.uuid] = store
 }
 
 func (s *stores) unset(store *Store) error {
 	if !s.has(store.uuid) {
 		return errors.New("store does not exist")
 	}
-	m := *s
-	delete(m, store.uuid)
-	s = &m
+	delete(*s, store.uuid)
 	return nil
 }
 
+func (s *stores) copy() *stores {
+	c := stores{}
+	for k, v := range *s {
+		c[k] = v
+	}
+	return &c
+}
+
+// list returns the stores ordered by name, then uuid. It locks each store to
+// read its name.
 func (s *stores) list() []*Store {
 	stores := []*Store{}
 	for _, v := range *s {
 		stores = append(stores, v)
 	}
+
+	names := map[*Store]string{}
+	for _, v := range stores {
+		names[v] = v.Name()
+	}
+
+	sort.Slice(stores, func(i, j int) bool {
+		if names[stores[i]] != names[stores[j]] {
+			return names[stores[i]] < names[stores[j]]
+		}
+		return stores[i].uuid.String() < stores[j].uuid.String()
+	})
 	return stores
 }
 
@@ -64,44 +85,32 @@ func (s *stores) json() StoresJSON {
 }
 
 func (s *stores) read(path string) (*Store, error) {
-	info, err := os.Stat(path)
-	if err != nil {
-		return nil, err
-	}
-
-	if info.IsDir() {
-		return nil, fmt.Errorf("%s is not a file", path)
-	}
-
-	b, err := os.ReadFile(path)
+	f, err := openFile(path)
 	if err != nil {
 		return nil, err
 	}
+	defer f.Close()
 
-	return s.readBytes(b)
+	return s.readFrom(f)
 }
 
-func (s *stores) readEncrypted(path, token string) (*Store, error) {
-	info, err := os.Stat(path)
+func (s *stores) readEncrypted(path, passphrase string) (*Store, error) {
+	f, err := openFile(path)
 	if err != nil {
 		return nil, err
 	}
+	defer f.Close()
 
-	if info.IsDir() {
-		return nil, fmt.Errorf("%s is not a file", path)
-	}
-
-	b, err := os.ReadFile(path)
-	if err != nil {
-		return nil, err
-	}
+	return s.readEncryptedFrom(f, passphrase)
+}
 
-	b, err = decrypt(token, b)
+func (s *stores) readEncryptedFrom(r io.Reader, passphrase string) (*Store, error) {
+	d, err := newDecryptReader(r, passphrase)
 	if err != nil {
 		return nil, err
 	}
 
-	return s.readBytes(b)
+	return s.readFrom(d)
 }
 
 func (s *stores) readBase64(data string) (*Store, error) {
@@ -113,18 +122,48 @@ func (s *stores) readBase64(data string) (*Store, error) {
 }
 
 func (s *stores) readBytes(data []byte) (*Store, error) {
-	f := string(data)
-	if !strings.HasPrefix(f, "PINDBSTORE:\n") {
-		return nil, errors.New("invalid pindb store file")
+	return s.readFrom(bytes.NewReader(data))
+}
+
+// readFrom parses a store one record at a time.
+func (s *stores) readFrom(r io.Reader) (*Store, error) {
+	br := bufio.NewReader(r)
+	header, err := br.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	version, err := parseHeader(strings.TrimSuffix(header, "\n"))
+	if err != nil {
+		return nil, err
 	}
 
-	f = strings.TrimPrefix(f, "PINDBSTORE:\n")
 	v := &Store{
 		uuid:    uuid.New(),
 		buckets: &buckets{},
+		queue:   newOperations(),
+		version: version,
+		unknown: []unknownRecord{},
 	}
 
-	for i, l := range strings.Split(f, "\n") {
+	// the key of the last known record, which unknown records are kept after
+	after := storeHeader
+	for i := 0; ; i++ {
+		l, err := br.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+
+		if l == "" && errors.Is(err, io.EOF) {
+			break
+		}
+
+		l, err = migrate(version, strings.TrimSuffix(l, "\n"))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", i+2, err.Error())
+		}
+
+		key, known := recordKey(l), true
 		switch true {
 		case strings.HasPrefix(l, "UA\u2063"):
 			ts := strings.Split(l, "\u2063")[1]
@@ -135,22 +174,23 @@ func (s *stores) readBytes(data []byte) (*Store, error) {
 				}
 				v.refreshedAt = &u
 			}
-		case strings.HasPrefix(l, "SN\u2063"):
-			v.name = strings.Split(l, "\u2063")[1]
-		case strings.HasPrefix(l, "SU\u2063"):
-			t := strings.Split(l, "\u2063")[1]
-			u, err := newUser(t)
+		case strings.HasPrefix(l, "UC\u2063"):
+			n, err := strconv.Atoi(strings.Split(l, "\u2063")[1])
 			if err != nil {
 				return nil, fmt.Errorf("line %d: %s", i+2, err.Error())
 			}
-
-			u.pb = pinboard.New(t)
-			err = u.Authenticate()
+			v.untracked = n
+		case strings.HasPrefix(l, "SM\u2063"):
+			v.manifest = strings.Split(l, "\u2063")[1] == "true"
+		case strings.HasPrefix(l, "SN\u2063"):
+			v.name = unescape(strings.Split(l, "\u2063")[1])
+		case strings.HasPrefix(l, "SU\u2063"):
+			t := unescape(strings.Split(l, "\u2063")[1])
+			u, err := newUser(t)
 			if err != nil {
 				return nil, fmt.Errorf("line %d: %s", i+2, err.Error())
 			}
 
-			v.pb = u.pb
 			v.user = u
 		case strings.HasPrefix(l, "SI\u2063"):
 			uid, err := uuid.Parse(strings.Split(l, "\u2063")[1])
@@ -180,7 +220,7 @@ func (s *stores) readBytes(data []byte) (*Store, error) {
 				t = &u
 			}
 
-			b, err := newBucket(v, parts[2])
+			b, err := newBucket(v, unescape(parts[2]))
 			if err != nil {
 				return nil, fmt.Errorf("line %d: %s", i+2, err.Error())
 			}
@@ -188,6 +228,14 @@ func (s *stores) readBytes(data []byte) (*Store, error) {
 			b.uuid = uid
 			b.refreshedAt = t
 			v.buckets.set(b)
+		case strings.HasPrefix(l, "G\u2063"):
+			l = strings.TrimPrefix(l, "G\u2063")
+			g, err := parseGroup(v, strings.Split(l, "\u2063"))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", i+2, err.Error())
+			}
+
+			g.bucket.groups.set(g)
 		case strings.HasPrefix(l, "L\u2063"):
 			l = strings.TrimPrefix(l, "L\u2063")
 			parts := strings.Split(l, "\u2063")
@@ -205,12 +253,12 @@ func (s *stores) readBytes(data []byte) (*Store, error) {
 				return nil, fmt.Errorf("line %d: %s", i+2, err.Error())
 			}
 
-			b, err := v.Bucket(buid)
+			b, err := v.buckets.get(buid)
 			if err != nil {
 				return nil, fmt.Errorf("line %d: %s", i+2, err.Error())
 			}
 
-			u, err := url.Parse(parts[2])
+			u, err := url.Parse(unescape(parts[2]))
 			if err != nil {
 				return nil, fmt.Errorf("line %d: %s", i+2, err.Error())
 			}
@@ -225,19 +273,37 @@ func (s *stores) readBytes(data []byte) (*Store, error) {
 				tags.add(t)
 			}
 
-			n, err := newLink(b, parts[3], u, formatTag(parts[4]), tags...)
+			n, err := newLink(b, unescape(parts[3]), u, formatTag(unescape(parts[4])), tags...)
 			if err != nil {
 				return nil, fmt.Errorf("line %d: %s", i+2, err.Error())
 			}
 
 			n.uuid = uid
+			_, n.group = b.ensureGroup(n.group)
 			n.description = n.record()
-			n.Validate()
+			n.validate()
 			b.links.set(n)
+		case strings.HasPrefix(l, "Q\u2063"):
+			l = strings.TrimPrefix(l, "Q\u2063")
+			op, err := parseOperation(strings.Split(l, "\u2063"))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", i+2, err.Error())
+			}
+
+			v.queue.add(op)
+		case strings.TrimSpace(l) != "":
+			// written by a newer client, kept for the export
+			v.unknown = append(v.unknown, unknownRecord{after: after, record: l})
+			known = false
+		default:
+			known = false
+		}
+
+		if known {
+			after = key
 		}
 	}
 
-	s.set(v)
 	return v, nil
 }
 
@@ -245,25 +311,58 @@ func newStores() *stores {
 	return &stores{}
 }
 
+// Store is safe for concurrent use, as are its buckets, groups and links.
+// They share the lock of the store, which is only held to read or change
+// them. Calls to the backend are made without it, one operation at a time
+// under remote, so that a slow or rate limited call does not hold up reads.
 type Store struct {
+	mu          sync.RWMutex
+	remote      sync.Mutex
 	refreshedAt *time.Time
 	user        *user
 	name        string
 	uuid        uuid.UUID
 	buckets     *buckets
+	queue       *operations
+	untracked   int
+	manifest    bool
+	version     int
+	unknown     []unknownRecord
 	client      *Client
-	pb          *pinboard.Client
+	tx          *Tx
+
+	// touched lists the links whose queued changes are pushed once the
+	// change that queued them is done
+	touched []uuid.UUID
 }
 
 func (s *Store) Buckets() []*Bucket {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	return s.buckets.list()
 }
 
+// Tags counts the user tags on the links of every bucket in the store.
+func (s *Store) Tags() map[Tag]int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	links := []*Link{}
+	for _, b := range s.buckets.list() {
+		links = append(links, b.links.list()...)
+	}
+	return countTags(links)
+}
+
 func (s *Store) RefreshedAt() *time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	return s.refreshedAt
 }
 
 func (s *Store) Name() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	return s.name
 }
 
@@ -276,14 +375,21 @@ func (s *Store) Tag() Tag {
 }
 
 func (s *Store) Bucket(uuid uuid.UUID) (*Bucket, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	return s.buckets.get(uuid)
 }
 
 func (s *Store) Has(uuid uuid.UUID) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	return s.buckets.has(uuid)
 }
 
 func (s *Store) Add(name string) (*Bucket, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	b, err := newBucket(s, name)
 	if err != nil {
 		return nil, err
@@ -294,93 +400,159 @@ func (s *Store) Add(name string) (*Bucket, error) {
 }
 
 func (s *Store) Rename(name string) *Store {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	s.name = name
 	return s
 }
 
 func (s *Store) Remove(removeLinks, removeTags bool) (*Store, error) {
-	if removeLinks || removeTags {
-		for _, b := range *s.buckets {
-			_, err := b.Remove(removeLinks, removeLinks)
-			if err != nil {
-				return s, err
-			}
-		}
-		if removeTags {
-			tag := fmt.Sprintf("/pindb/store:\"%s\"", s.uuid.String())
-			err := s.pb.Tags.Delete(tag)
-			if err != nil {
-				return s, err
-			}
-		}
+	return s.RemoveContext(context.Background(), removeLinks, removeTags)
+}
+
+func (s *Store) RemoveContext(ctx context.Context, removeLinks, removeTags bool) (*Store, error) {
+	err := s.remove(ctx, removeLinks, removeTags)
+	if err != nil {
+		return s, err
 	}
-	s.client.stores.unset(s)
+
+	// the client locks the stores it holds, so this must not be done with
+	// the lock of the store held
+	s.client.remove(s)
 	return nil, nil
 }
 
-func (s *Store) Write(path string) error {
-	info, err := os.Stat(path)
-	if err != nil && !errors.Is(err, os.ErrNotExist) {
-		return err
-	}
+func (s *Store) remove(ctx context.Context, removeLinks, removeTags bool) error {
+	s.remote.Lock()
+	defer s.remote.Unlock()
+
+	s.mu.RLock()
+	tx := s.tx
+	buckets := s.buckets.list()
+	s.mu.RUnlock()
 
-	if err == nil && info.IsDir() {
-		return fmt.Errorf("%s is not a file", path)
+	if tx != nil {
+		return ErrTransaction
 	}
 
-	err = os.WriteFile(
-		path,
-		s.WriteBytes(),
-		0644,
-	)
+	if !removeLinks && !removeTags {
+		return nil
+	}
 
+	api, err := s.api(ctx)
 	if err != nil {
 		return err
 	}
 
+	for _, b := range buckets {
+		err := b.remove(ctx, removeLinks, removeLinks)
+		if err != nil {
+			return err
+		}
+	}
+	if removeTags {
+		tag := fmt.Sprintf("/pindb/store:\"%s\"", s.uuid.String())
+		err := api.DeleteTag(ctx, tag)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+func (s *Store) Write(path string) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return writeFile(path, s.client.keep(), func(w io.Writer) error {
+		_, err := s.writeTo(w)
+		return err
+	})
+}
+
 func (s *Store) WriteEncrypted(path string, passphrase string) error {
-	info, err := os.Stat(path)
-	if err != nil && !errors.Is(err, os.ErrNotExist) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return writeFile(path, s.client.keep(), func(w io.Writer) error {
+		_, err := s.writeEncryptedTo(w, passphrase)
 		return err
-	}
+	})
+}
+
+func (s *Store) WriteBytes() []byte {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var b bytes.Buffer
+	s.writeTo(&b)
+	return b.Bytes()
+}
 
-	if err == nil && info.IsDir() {
-		return fmt.Errorf("%s is not a file", path)
+// WriteTo writes the store one record at a time.
+func (s *Store) WriteTo(w io.Writer) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.writeTo(w)
+}
+
+// writeTo writes the store in FormatVersion. Records written by a newer
+// client are kept where they were in the file the store was read from.
+func (s *Store) writeTo(w io.Writer) (int64, error) {
+	c := &countWriter{w: w}
+	u := newUnknownWriter(c, s.unknown)
+	b := bufio.NewWriter(u)
+	fmt.Fprintf(b, "%s\n", formatHeader(FormatVersion))
+	if s.refreshedAt != nil {
+		fmt.Fprintf(b, "UA\u2063%s\n", s.refreshedAt.Format(time.RFC3339))
+		fmt.Fprintf(b, "UC\u2063%d\n", s.untracked)
 	}
+	fmt.Fprintf(b, "SN\u2063%s\n", escape(s.name))
+	fmt.Fprintf(b, "SU\u2063%s\n", escape(s.user.token))
+	fmt.Fprintf(b, "SI\u2063%s\n", s.uuid)
+	if s.manifest {
+		fmt.Fprint(b, "SM\u2063true\n")
+	}
+	s.buckets.writeTo(b)
+	b.Write(s.queue.writeBytes())
 
-	b := s.WriteBytes()
-	enc, err := encrypt(passphrase, b)
+	// a bufio.Writer keeps the first error, so it surfaces here
+	err := b.Flush()
 	if err != nil {
-		return err
+		return c.n, err
 	}
 
-	err = os.WriteFile(
-		path,
-		enc,
-		0644,
-	)
+	err = u.Close()
+	return c.n, err
+}
 
+// WriteEncryptedTo encrypts the store as it is written.
+func (s *Store) WriteEncryptedTo(w io.Writer, passphrase string) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.writeEncryptedTo(w, passphrase)
+}
+
+func (s *Store) writeEncryptedTo(w io.Writer, passphrase string) (int64, error) {
+	c := &countWriter{w: w}
+	e, err := newEncryptWriter(c, passphrase)
 	if err != nil {
-		return err
+		return c.n, err
 	}
 
-	return nil
+	_, err = s.writeTo(e)
+	if err != nil {
+		return c.n, err
+	}
+
+	err = e.Close()
+	return c.n, err
 }
 
-func (s *Store) WriteBytes() []byte {
-	var b bytes.Buffer
-	fmt.Fprint(&b, "PINDBSTORE:\n")
-	if s.refreshedAt != nil {
-		fmt.Fprintf(&b, "UA\u2063%s\n", s.refreshedAt.Format(time.RFC3339))
-	}
-	fmt.Fprintf(&b, "SN\u2063%s\n", s.name)
-	fmt.Fprintf(&b, "SU\u2063%s\n", s.user.token)
-	fmt.Fprintf(&b, "SI\u2063%s\n", s.uuid)
-	b.Write(s.buckets.writeBytes())
-	return b.Bytes()
+// Version is the format version of the file the store was read from.
+func (s *Store) Version() int {
+	return s.version
 }
 
 func (s *Store) WriteBase64() string {
@@ -388,114 +560,96 @@ func (s *Store) WriteBase64() string {
 	return base64.RawStdEncoding.EncodeToString(b)
 }
 
-func (s *Store) authenticate() error {
-	err := s.user.Authenticate()
+func (s *Store) authenticate(ctx context.Context, api Backend) error {
+	err := s.user.Authenticate(ctx, api)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (s *Store) Refresh(force bool) (*Store, error) {
-	if !force {
-		refreshed, err := s.Updated()
-		if err != nil {
-			return s, err
-		}
-
-		if !refreshed {
-			return s, err
-		}
+// api returns the backend of the store, authenticating on first use. It is
+// called with remote held.
+func (s *Store) api(ctx context.Context) (Backend, error) {
+	if s.client != nil && s.client.offline {
+		return nil, ErrOffline
 	}
 
-	posts, err := s.pb.Posts.All(&pinboard.PostsAllOptions{
-		Tag: []string{
-			fmt.Sprintf(
-				"/pindb/store:\"%s\"",
-				s.uuid.String())},
-	})
-
-	if err != nil {
-		return s, err
+	if s.user.backend == nil {
+		s.user.backend = s.client.newBackend(s.user.token)
 	}
 
-	for _, bucket := range *s.buckets {
-		bucket.links = newLinks()
+	api := &accountBackend{
+		backend: s.user.backend,
+		account: s.client.account(s.user.token),
 	}
 
-	for _, post := range posts {
-		buckets := []*Bucket{}
-		tags := newTags().populate(post.Tags...)
-		rg := regexp.MustCompile(`^/pindb/store:\"\"/bucket:\"([0-9a-f\-]+)\"$`)
-		for _, tag := range tags {
-			if rg.MatchString(tag.String()) {
-				uid := rg.FindStringSubmatch(tag.String())[1]
-				puid, err := uuid.Parse(uid)
-				if err == nil {
-					bucket, err := s.buckets.get(puid)
-					if err == nil {
-						buckets = append(buckets, bucket)
-					}
-				}
-			}
+	if !s.user.authenticated {
+		err := s.authenticate(ctx, api)
+		if err != nil {
+			return nil, err
 		}
-		for _, bucket := range buckets {
-			link, err := newLink(
-				bucket,
-				post.Description,
-				post.Href,
-				NewTag(""),
-				newTags().populate(post.Tags...)...,
-			)
+	}
 
-			if err != nil {
-				return s, err
-			}
+	return api, nil
+}
 
-			uid := link.url.Query().Get("pindbuuid")
-			if strings.TrimSpace(uid) == "" {
-				q := link.url.Query()
-				q.Set("pindbuuid", link.uuid.String())
-				link.url.RawQuery = q.Encode()
-			} else {
-				puid, err := uuid.Parse(uid)
-				if err == nil {
-					link.uuid = puid
-				}
-			}
+// Refresh updates the links from the backend and reports what changed.
+// Unless force is set, nothing is fetched when the posts of the account did
+// not change since the last refresh.
+func (s *Store) Refresh(force bool) (*RefreshResult, error) {
+	return s.RefreshContext(context.Background(), force)
+}
 
-			rg := regexp.MustCompile(fmt.Sprintf(`^/pindb/bucket:\"%s\"/group:\"([0-9a-f\-]+)\"$`, link.bucket.uuid.String()))
-			for _, t := range link.tags {
-				if rg.MatchString(t.String()) {
-					link.group = NewTag(rg.FindStringSubmatch(t.String())[1])
-				}
-			}
+// RefreshContext is Refresh with every call to the backend bounded by ctx.
+// When ctx is done the refresh stops with its error and the links are left
+// as they were. The store can be read while the refresh waits on the
+// backend.
+func (s *Store) RefreshContext(ctx context.Context, force bool) (*RefreshResult, error) {
+	s.remote.Lock()
+	defer s.remote.Unlock()
+	return s.refresh(ctx, force, false)
+}
 
-			link.description = link.record()
-			link.Validate()
-			bucket.links.set(link)
-		}
-	}
+// Preview reports what Refresh would change without applying it.
+func (s *Store) Preview(force bool) (*RefreshResult, error) {
+	return s.PreviewContext(context.Background(), force)
+}
 
-	ut := time.Now()
-	s.refreshedAt = &ut
-	return s, nil
+func (s *Store) PreviewContext(ctx context.Context, force bool) (*RefreshResult, error) {
+	s.remote.Lock()
+	defer s.remote.Unlock()
+	return s.refresh(ctx, force, true)
 }
 
 func (s *Store) Updated() (bool, error) {
-	if s.refreshedAt == nil {
+	return s.UpdatedContext(context.Background())
+}
+
+func (s *Store) UpdatedContext(ctx context.Context) (bool, error) {
+	s.remote.Lock()
+	defer s.remote.Unlock()
+
+	s.mu.RLock()
+	since := s.refreshedAt
+	s.mu.RUnlock()
+
+	if since == nil {
 		return true, nil
 	}
 
-	t, err := s.pb.Posts.Update()
+	api, err := s.api(ctx)
 	if err != nil {
 		return false, err
 	}
 
-	return t.After(*s.refreshedAt), nil
+	return changed(ctx, api, since)
 }
 
 func (s *Store) JSON() StoreJSON {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	j := StoreJSON{}
 	if s.refreshedAt != nil {
 		j.RefreshedAt = s.refreshedAt.Format(time.RFC3339)
@@ -503,35 +657,36 @@ func (s *Store) JSON() StoreJSON {
 	j.User = s.user.JSON()
 	j.Name = s.name
 	j.UUID = s.uuid.String()
+	j.Manifest = s.manifest
 	j.Buckets = s.buckets.json()
+	j.Pending = s.queue.json()
+	j.Untracked = s.untracked
+	j.Version = s.version
+	j.Unknown = []string{}
+	for _, u := range s.unknown {
+		j.Unknown = append(j.Unknown, u.record)
+	}
 	return j
 }
 
-func newStore(client *Client, token, name string) (*Store, error) {
-	if strings.Contains(token, "\u2063") {
-		return nil, errors.New("token cannot contain invisible separator (U+2063)")
-	}
-
-	if strings.Contains(name, "\u2063") {
-		return nil, errors.New("name cannot contain invisible separator (U+2063)")
-	}
-
+func newStore(ctx context.Context, client *Client, token, name string) (*Store, error) {
 	user, err := newUser(token)
 	if err != nil {
 		return nil, err
 	}
 
-	user.pb = pinboard.New(token)
-
 	s := &Store{
 		name:    name,
 		user:    user,
 		uuid:    uuid.New(),
 		buckets: newBuckets(),
+		queue:   newOperations(),
+		version: FormatVersion,
+		unknown: []unknownRecord{},
 		client:  client,
 	}
 
-	err = s.authenticate()
+	_, err = s.api(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -542,9 +697,14 @@ func newStore(client *Client, token, name string) (*Store, error) {
 type StoresJSON []StoreJSON
 
 type StoreJSON struct {
-	RefreshedAt string      `json:"refreshed_at,omitempty"`
-	User        UserJSON    `json:"user,omitempty"`
-	Name        string      `json:"name,omitempty"`
-	UUID        string      `json:"uuid,omitempty"`
-	Buckets     BucketsJSON `json:"buckets,omitempty"`
+	RefreshedAt string         `json:"refreshed_at,omitempty"`
+	User        UserJSON       `json:"user,omitempty"`
+	Name        string         `json:"name,omitempty"`
+	UUID        string         `json:"uuid,omitempty"`
+	Manifest    bool           `json:"manifest,omitempty"`
+	Buckets     BucketsJSON    `json:"buckets,omitempty"`
+	Pending     OperationsJSON `json:"pending,omitempty"`
+	Untracked   int            `json:"untracked,omitempty"`
+	Version     int            `json:"version,omitempty"`
+	Unknown     []string       `json:"unknown,omitempty"`
 }
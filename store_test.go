@@ -0,0 +1,187 @@
+package pindb
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tmstn/pinboard"
+)
+
+func newTestStore(t *testing.T, backend Backend) (*Store, *Bucket) {
+	t.Helper()
+
+	s, err := New(WithBackend(backend)).Add("user:token", "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := s.Add("bucket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, b
+}
+
+func mustParse(t *testing.T, raw string) *url.URL {
+	t.Helper()
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+// blockingBackend holds every call to All until release is closed.
+type blockingBackend struct {
+	*MemoryBackend
+	started chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func newBlockingBackend() *blockingBackend {
+	return &blockingBackend{
+		MemoryBackend: NewMemoryBackend(),
+		started:       make(chan struct{}),
+		release:       make(chan struct{}),
+	}
+}
+
+func (b *blockingBackend) All(ctx context.Context, opts *pinboard.PostsAllOptions) ([]*pinboard.Post, error) {
+	b.once.Do(func() { close(b.started) })
+
+	select {
+	case <-b.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return b.MemoryBackend.All(ctx, opts)
+}
+
+func TestStoreReadsDuringRefresh(t *testing.T) {
+	m := newBlockingBackend()
+	s, b := newTestStore(t, m)
+
+	_, err := b.Add("link", mustParse(t, "https://example.com"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refreshed := make(chan error, 1)
+	go func() {
+		_, err := s.Refresh(true)
+		refreshed <- err
+	}()
+	<-m.started
+
+	read := make(chan struct{})
+	go func() {
+		defer close(read)
+		s.Name()
+		s.JSON()
+		s.Pending()
+		b.Links()
+	}()
+
+	select {
+	case <-read:
+	case <-time.After(5 * time.Second):
+		t.Fatal("reads waited for the backend")
+	}
+
+	close(m.release)
+	if err := <-refreshed; err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(b.Links()); n != 1 {
+		t.Fatalf("got %d links after refresh, want 1", n)
+	}
+}
+
+func TestStoreConcurrentChanges(t *testing.T) {
+	m := NewMemoryBackend()
+	s, b := newTestStore(t, m)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			l, err := b.Add("link", mustParse(t, fmt.Sprintf("https://example.com/%d", i)), nil)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			if _, err := l.SetTitle(fmt.Sprintf("link %d", i)); err != nil {
+				t.Error(err)
+			}
+			if _, err := s.Refresh(false); err != nil {
+				t.Error(err)
+			}
+
+			s.JSON()
+			s.WriteBytes()
+			s.client.Stores()
+
+			if err := l.Remove(); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if n := len(b.Links()); n != 0 {
+		t.Errorf("got %d links, want 0", n)
+	}
+	if n := len(s.Pending()); n != 0 {
+		t.Errorf("got %d pending operations, want 0", n)
+	}
+	if n := len(m.posts); n != 0 {
+		t.Errorf("got %d posts on the backend, want 0", n)
+	}
+}
+
+func TestDiffBothWaysWhileWriting(t *testing.T) {
+	a, _ := newTestStore(t, NewMemoryBackend())
+	b, err := New().ReadBytes(a.WriteBytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		wg := sync.WaitGroup{}
+		for _, s := range [][2]*Store{{a, b}, {b, a}} {
+			wg.Add(2)
+			go func(before, after *Store) {
+				defer wg.Done()
+				for i := 0; i < 5000; i++ {
+					Diff(before, after)
+				}
+			}(s[0], s[1])
+			go func(s *Store) {
+				defer wg.Done()
+				for i := 0; i < 5000; i++ {
+					s.Rename(fmt.Sprintf("store %d", i))
+				}
+			}(s[0])
+		}
+		wg.Wait()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("diffs and writers deadlocked")
+	}
+}
@@ -47,8 +47,7 @@ func (t *Tags) remove(tags ...Tag) {
 	for _, tag := range tags {
 		if strings.TrimSpace(tag.String()) != "" && t.has(tag) {
 			index := t.index(tag)
-			*t = append(*t, (*t)[:index]...)
-			*t = append(*t, (*t)[index+1:]...)
+			*t = append((*t)[:index], (*t)[index+1:]...)
 		}
 	}
 }
@@ -74,18 +73,37 @@ func (t Tags) Less(i, j int) bool {
 }
 
 func (t Tags) record() []byte {
-	return []byte(strings.Join(t.Strings(), "\u2064"))
+	s := append(Tags{}, t...)
+	sort.Sort(s)
+
+	escaped := []string{}
+	for _, v := range s {
+		escaped = append(escaped, escape(v.String()))
+	}
+	return []byte(strings.Join(escaped, "\u2064"))
 }
 
 func (t Tags) parse(record []byte) Tags {
 	n := Tags{}
 	p := strings.Split(string(record), "\u2064")
 	for _, i := range p {
-		n.add(NewTag(i))
+		n.add(NewTag(unescape(i)))
 	}
 	return n
 }
 
+// countTags counts the user tags across links, leaving out the tags pindb
+// manages itself.
+func countTags(links []*Link) map[Tag]int {
+	counts := map[Tag]int{}
+	for _, l := range links {
+		for _, t := range l.userTags() {
+			counts[t]++
+		}
+	}
+	return counts
+}
+
 func newTags() Tags {
 	return Tags{}
 }
@@ -99,14 +117,6 @@ func (t Tag) String() string {
 func (t Tag) Validate() (bool, error) {
 	text := t.String()
 
-	if strings.Contains(text, "\u2063") {
-		return false, errors.New("tag cannot contain invisible separator (U+2063)")
-	}
-
-	if strings.Contains(text, "\u2064") {
-		return false, errors.New("tag cannot contain invisible plus (U+2064)")
-	}
-
 	if strings.Contains(text, " ") {
 		return false, errors.New("tag cannot contain spaces")
 	}
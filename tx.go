@@ -0,0 +1,370 @@
+package pindb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrTransaction is returned by changes that cannot be staged, such as
+	// deleting tags or removing the store, while a transaction is open.
+	ErrTransaction = errors.New("the store has an open transaction")
+
+	ErrTxDone = errors.New("transaction has already been committed or rolled back")
+)
+
+// Tx stages changes to a store so that they reach Pinboard and the store
+// file together or not at all. While it is open changes are applied
+// locally and queued but not pushed.
+type Tx struct {
+	store    *Store
+	snapshot []byte
+	buckets  map[uuid.UUID]*Bucket
+	groups   map[uuid.UUID]*Group
+	links    map[uuid.UUID]*links
+	staged   map[*Operation]bool
+	done     bool
+}
+
+// Begin opens a transaction on the store. Only one can be open at a time.
+// It waits for changes that are being pushed.
+func (s *Store) Begin() (*Tx, error) {
+	s.remote.Lock()
+	defer s.remote.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.tx != nil {
+		return nil, ErrTransaction
+	}
+
+	buf := bytes.Buffer{}
+	_, err := s.writeTo(&buf)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Tx{
+		store:    s,
+		snapshot: buf.Bytes(),
+		buckets:  map[uuid.UUID]*Bucket{},
+		groups:   map[uuid.UUID]*Group{},
+		links:    map[uuid.UUID]*links{},
+		staged:   map[*Operation]bool{},
+	}
+
+	// the objects are kept so that a rollback restores them in place
+	for _, b := range *s.buckets {
+		t.buckets[b.uuid] = b
+		t.links[b.uuid] = b.links.copy()
+		for _, g := range *b.groups {
+			t.groups[g.uuid] = g
+		}
+	}
+
+	s.tx = t
+	return t, nil
+}
+
+func (t *Tx) Commit(path string) error {
+	return t.CommitContext(context.Background(), path)
+}
+
+// CommitContext pushes the changes staged in the transaction in order, then
+// writes the store to path. Changes queued before the transaction began are
+// left for Push, unless a staged change to the same link was merged into
+// them. An empty path skips writing for callers that write the store
+// themselves. Offline nothing is pushed and the changes stay queued. When a
+// push or the write fails the changes already pushed are undone on the
+// backend and the store is rolled back.
+func (t *Tx) CommitContext(ctx context.Context, path string) error {
+	return t.commit(ctx, t.writeFile(path, func(w io.Writer) error {
+		_, err := t.store.writeTo(w)
+		return err
+	}))
+}
+
+func (t *Tx) CommitEncrypted(path, passphrase string) error {
+	return t.CommitEncryptedContext(context.Background(), path, passphrase)
+}
+
+func (t *Tx) CommitEncryptedContext(ctx context.Context, path, passphrase string) error {
+	return t.commit(ctx, t.writeFile(path, func(w io.Writer) error {
+		_, err := t.store.writeEncryptedTo(w, passphrase)
+		return err
+	}))
+}
+
+func (t *Tx) CommitTo(w io.Writer) error {
+	return t.CommitToContext(context.Background(), w)
+}
+
+// CommitToContext is CommitContext writing the store to w instead of a
+// file. When the write fails the commit is undone as when a file cannot be
+// written.
+func (t *Tx) CommitToContext(ctx context.Context, w io.Writer) error {
+	return t.commit(ctx, func() error {
+		_, err := t.store.writeTo(w)
+		return err
+	})
+}
+
+func (t *Tx) CommitEncryptedTo(w io.Writer, passphrase string) error {
+	return t.CommitEncryptedToContext(context.Background(), w, passphrase)
+}
+
+func (t *Tx) CommitEncryptedToContext(ctx context.Context, w io.Writer, passphrase string) error {
+	return t.commit(ctx, func() error {
+		_, err := t.store.writeEncryptedTo(w, passphrase)
+		return err
+	})
+}
+
+// writeFile returns the write of a commit to path, nil for an empty path.
+func (t *Tx) writeFile(path string, write func(w io.Writer) error) func() error {
+	if path == "" {
+		return nil
+	}
+
+	return func() error {
+		return writeFile(path, t.store.client.keep(), write)
+	}
+}
+
+// commit pushes with only remote held, so the store can be read while it
+// waits on the backend.
+func (t *Tx) commit(ctx context.Context, write func() error) error {
+	s := t.store
+	s.remote.Lock()
+	defer s.remote.Unlock()
+
+	s.mu.Lock()
+	if t.done {
+		s.mu.Unlock()
+		return ErrTxDone
+	}
+
+	ops := []*Operation{}
+	for _, op := range s.queue.list() {
+		if t.staged[op] {
+			ops = append(ops, op)
+		}
+	}
+	s.mu.Unlock()
+
+	// offline the changes stay queued, as they would outside a transaction
+	if s.client != nil && s.client.offline {
+		ops = nil
+	}
+
+	pushed := []*Operation{}
+	var err error
+	for _, op := range ops {
+		s.mu.RLock()
+		pushes := s.pushes(op)
+		s.mu.RUnlock()
+
+		err = s.replay(ctx, op)
+		if err != nil {
+			err = fmt.Errorf("%s %s: %w", op.kind, op.url, err)
+			break
+		}
+
+		if pushes {
+			pushed = append(pushed, op)
+		}
+	}
+
+	if err == nil && write != nil {
+		s.mu.RLock()
+		err = write()
+		s.mu.RUnlock()
+	}
+
+	if err == nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		t.close()
+		return nil
+	}
+
+	// undo what was pushed even when ctx is what stopped the commit
+	cerr := t.compensate(context.WithoutCancel(ctx), pushed)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer t.close()
+	rerr := t.restore()
+	return errors.Join(err, cerr, rerr)
+}
+
+// Rollback discards the changes made since Begin. Nothing has been pushed,
+// so only the local state is restored.
+func (t *Tx) Rollback() error {
+	s := t.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t.done {
+		return ErrTxDone
+	}
+	defer t.close()
+
+	return t.restore()
+}
+
+// stage records an operation queued in the transaction, nil when the change
+// cancelled out.
+func (t *Tx) stage(op *Operation) {
+	if op != nil {
+		t.staged[op] = true
+	}
+}
+
+func (t *Tx) close() {
+	t.done = true
+	t.store.tx = nil
+}
+
+// pushes reports whether replaying op sends anything to the backend. Adds
+// and replaces of links that no longer exist are dropped.
+func (s *Store) pushes(op *Operation) bool {
+	if op.kind == DeleteOperation {
+		return true
+	}
+
+	b, err := s.buckets.get(op.bucket)
+	return err == nil && b.links.has(op.link)
+}
+
+// compensate undoes pushed operations, latest first, by putting the links
+// back as they were when the transaction began. For a link with no changes
+// queued before then, that is the post the backend held. A link that had
+// changes queued gets them pushed instead, and they stay queued once the
+// store is restored. It is called with remote held and mu not.
+func (t *Tx) compensate(ctx context.Context, pushed []*Operation) error {
+	before, err := newStores().readBytes(t.snapshot)
+	if err != nil {
+		return err
+	}
+
+	api, err := t.store.api(ctx)
+	if err != nil {
+		return fmt.Errorf("undoing pushed changes: %w", err)
+	}
+
+	errs := []error{}
+	for i := len(pushed) - 1; i >= 0; i-- {
+		op := pushed[i]
+		err := undo(ctx, api, op, remoteLink(before, op))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("undoing %s %s: %w", op.kind, op.url, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		errs = append(errs, errors.New("refresh the store to pick up the changes that could not be undone"))
+	}
+	return errors.Join(errs...)
+}
+
+// remoteLink returns the link op changed as it was when the snapshot was
+// taken, nil when it had not reached the backend.
+func remoteLink(before *Store, op *Operation) *Link {
+	b, err := before.buckets.get(op.bucket)
+	if err != nil {
+		return nil
+	}
+
+	l, err := b.links.get(op.link)
+	if err != nil || before.queue.unpushed(op.link) {
+		return nil
+	}
+	return l
+}
+
+func undo(ctx context.Context, api Backend, op *Operation, before *Link) error {
+	if op.kind == DeleteOperation {
+		if before == nil || before.url.String() != op.url {
+			return nil
+		}
+		return api.Add(ctx, before.options(true))
+	}
+
+	if before == nil || before.url.String() != op.url {
+		err := api.Delete(ctx, op.url)
+		if errors.Is(err, ErrNotFound) {
+			err = nil
+		}
+
+		if err != nil || before == nil {
+			return err
+		}
+	}
+	return api.Add(ctx, before.options(true))
+}
+
+// restore puts the store back as it was when the transaction began. Buckets,
+// groups and links keep their objects, so pointers held by callers stay
+// current, including those to links removed in the transaction.
+func (t *Tx) restore() error {
+	from, err := newStores().readBytes(t.snapshot)
+	if err != nil {
+		return err
+	}
+
+	s := t.store
+	s.refreshedAt = from.refreshedAt
+	s.name = from.name
+	s.untracked = from.untracked
+	s.manifest = from.manifest
+	s.version = from.version
+	s.unknown = from.unknown
+	s.queue = from.queue
+
+	buckets := newBuckets()
+	for _, fb := range *from.buckets {
+		b := t.buckets[fb.uuid]
+		b.name = fb.name
+		b.refreshedAt = fb.refreshedAt
+
+		groups := newGroups()
+		for _, fg := range *fb.groups {
+			g := t.groups[fg.uuid]
+			g.name = fg.name
+			g.order = fg.order
+			g.bucket = b
+			groups.set(g)
+		}
+
+		links := newLinks()
+		for _, fl := range *fb.links {
+			l, err := t.links[b.uuid].get(fl.uuid)
+			if err != nil {
+				return err
+			}
+
+			l.title = fl.title
+			l.description = fl.description
+			l.url = fl.url
+			l.group = fl.group
+			l.tags = fl.tags
+			l.warnings = fl.warnings
+			l.bucket = b
+			links.set(l)
+		}
+
+		b.groups = groups
+		b.links = links
+		buckets.set(b)
+	}
+
+	s.buckets = buckets
+	return nil
+}
@@ -0,0 +1,213 @@
+package pindb
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/tmstn/pinboard"
+)
+
+// rejectingBackend fails to add the post at url.
+type rejectingBackend struct {
+	*MemoryBackend
+	url string
+}
+
+func (r *rejectingBackend) Add(ctx context.Context, opts *pinboard.PostsAddOptions) error {
+	if opts.URL == r.url {
+		return errors.New("error: http 400")
+	}
+	return r.MemoryBackend.Add(ctx, opts)
+}
+
+func title(t *testing.T, m *MemoryBackend, l *Link) string {
+	t.Helper()
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	p, ok := m.posts[l.URL(true).String()]
+	if !ok {
+		t.Fatalf("no post for %s", l.URL(false))
+	}
+	return p.Description
+}
+
+func TestTxCommitPushesStagedChangesOnly(t *testing.T) {
+	m := &failingBackend{MemoryBackend: NewMemoryBackend()}
+	s, b := newTestStore(t, m)
+
+	l, err := b.Add("a", mustParse(t, "https://example.com/a"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stale, err := b.Add("b", mustParse(t, "https://example.com/b"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m.setFail(true)
+	if _, err := stale.SetTitle("stale"); !errors.Is(err, ErrQueued) {
+		t.Fatalf("got %v, want ErrQueued", err)
+	}
+	m.setFail(false)
+
+	tx, err := s.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := l.SetTitle("changed"); err != nil {
+		t.Fatal(err)
+	}
+	if got := title(t, m.MemoryBackend, l); got != "a" {
+		t.Fatalf("got %q on the backend before commit, want nothing pushed", got)
+	}
+
+	if err := tx.Commit(""); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := title(t, m.MemoryBackend, l); got != "changed" {
+		t.Errorf("got %q on the backend, want the staged change", got)
+	}
+	if got := title(t, m.MemoryBackend, stale); got != "b" {
+		t.Errorf("got %q on the backend, want the older change left for push", got)
+	}
+	if p := s.Pending(); len(p) != 1 || p[0].Link() != stale.UUID() {
+		t.Errorf("got %v pending, want the older change", p)
+	}
+}
+
+func TestTxCompensatesFailedPush(t *testing.T) {
+	m := &rejectingBackend{MemoryBackend: NewMemoryBackend()}
+	s, b := newTestStore(t, m)
+
+	a, err := b.Add("a", mustParse(t, "https://example.com/a"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rejected, err := b.Add("b", mustParse(t, "https://example.com/b"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.url = rejected.URL(true).String()
+
+	tx, err := s.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := a.SetTitle("changed"); err != nil {
+		t.Fatal(err)
+	}
+
+	added, err := b.Add("c", mustParse(t, "https://example.com/c"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addedURL := added.URL(true).String()
+
+	if _, err := rejected.SetTitle("changed"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tx.Commit(""); err == nil {
+		t.Fatal("commit succeeded with a rejected push")
+	}
+
+	// the changes pushed before the failure are undone on the backend
+	if got := title(t, m.MemoryBackend, a); got != "a" {
+		t.Errorf("got %q on the backend, want the change undone", got)
+	}
+	if _, ok := m.posts[addedURL]; ok {
+		t.Error("the added link is still on the backend")
+	}
+
+	// and the store is rolled back
+	if a.Title() != "a" || rejected.Title() != "b" {
+		t.Errorf("got titles %q and %q, want them rolled back", a.Title(), rejected.Title())
+	}
+	if n := len(b.Links()); n != 2 {
+		t.Errorf("got %d links, want 2", n)
+	}
+	if n := len(s.Pending()); n != 0 {
+		t.Errorf("got %d pending, want 0", n)
+	}
+
+	if err := tx.Rollback(); !errors.Is(err, ErrTxDone) {
+		t.Errorf("got %v rolling back a failed commit, want ErrTxDone", err)
+	}
+}
+
+func TestTxCompensatesFailedWrite(t *testing.T) {
+	m := NewMemoryBackend()
+	s, b := newTestStore(t, m)
+
+	l, err := b.Add("a", mustParse(t, "https://example.com/a"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := s.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := l.SetTitle("changed"); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "missing", "store.pindb")
+	if err := tx.Commit(path); err == nil {
+		t.Fatal("commit succeeded without writing the store")
+	}
+
+	if got := title(t, m, l); got != "a" {
+		t.Errorf("got %q on the backend, want the change undone", got)
+	}
+	if l.Title() != "a" {
+		t.Errorf("got title %q, want it rolled back", l.Title())
+	}
+}
+
+// brokenWriter fails every write, as stdout does when its reader is gone.
+type brokenWriter struct{}
+
+func (brokenWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+func TestTxCompensatesFailedWriteTo(t *testing.T) {
+	m := NewMemoryBackend()
+	s, b := newTestStore(t, m)
+
+	l, err := b.Add("a", mustParse(t, "https://example.com/a"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := s.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := l.SetTitle("changed"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tx.CommitTo(brokenWriter{}); err == nil {
+		t.Fatal("commit succeeded without writing the store")
+	}
+
+	if got := title(t, m, l); got != "a" {
+		t.Errorf("got %q on the backend, want the change undone", got)
+	}
+	if l.Title() != "a" {
+		t.Errorf("got title %q, want it rolled back", l.Title())
+	}
+}
@@ -1,17 +1,17 @@
 package pindb
 
 import (
+	"context"
 	"errors"
 	"strings"
-
-	"github.com/tmstn/pinboard"
 )
 
 type user struct {
-	token    string
-	username string
-	key      string
-	pb       *pinboard.Client
+	token         string
+	username      string
+	key           string
+	authenticated bool
+	backend       Backend
 }
 
 func (u *user) Token() string {
@@ -26,11 +26,12 @@ func (u *user) Key() string {
 	return u.key
 }
 
-func (u *user) Authenticate() error {
-	_, err := u.pb.User.Secret()
+func (u *user) Authenticate(ctx context.Context, api Backend) error {
+	err := api.Authenticate(ctx)
 	if err != nil {
 		return err
 	}
+	u.authenticated = true
 	return nil
 }
 
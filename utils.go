@@ -1,34 +1,331 @@
 package pindb
 
 import (
+	"bufio"
+	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/binary"
 	"errors"
 	"io"
+
+	"golang.org/x/crypto/scrypt"
 )
 
-func encrypt(key string, plaintext []byte) ([]byte, error) {
-	sha := sha256.Sum256([]byte(key))
-	block, err := aes.NewCipher(sha[0:])
+const (
+	envelopeMagic    = "PINDBENC"
+	envelopeSaltSize = 16
+	envelopeLogN     = 15
+	envelopeR        = 8
+	envelopeP        = 1
+
+	// version 1 seals the whole store in one piece, version 2 in chunks so
+	// that it can be streamed
+	envelopeVersion       = 1
+	envelopeStreamVersion = 2
+
+	envelopeChunkSize = 64 * 1024
+	envelopeFinal     = 1 << 31
+)
+
+var ErrDecrypt = errors.New("incorrect passphrase or corrupted store file")
+
+// encryptWriter seals a stream in a versioned envelope:
+//
+//	magic | version | log2(N) | r | p | salt | nonce prefix | chunks
+//
+// The key is derived from the passphrase with scrypt. Each chunk is a
+// length, with the top bit set on the last one, followed by AES-256-GCM
+// ciphertext. Chunk nonces are the prefix, a counter and the last-chunk
+// flag, and the header is authenticated as additional data, so chunks
+// cannot be reordered, dropped or truncated without failing to decrypt.
+type encryptWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	ad      []byte
+	prefix  []byte
+	counter uint32
+	buf     []byte
+}
+
+func newEncryptWriter(w io.Writer, passphrase string) (*encryptWriter, error) {
+	salt := make([]byte, envelopeSaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+
+	var header bytes.Buffer
+	header.WriteString(envelopeMagic)
+	header.Write([]byte{envelopeStreamVersion, envelopeLogN, envelopeR, envelopeP})
+	header.Write(salt)
+
+	aead, err := newEnvelopeAEAD(passphrase, salt, envelopeLogN, envelopeR, envelopeP)
 	if err != nil {
 		return nil, err
 	}
 
-	ciphertext := make([]byte, aes.BlockSize+len(plaintext))
-	iv := ciphertext[:aes.BlockSize]
-	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+	prefix := make([]byte, aead.NonceSize()-5)
+	if _, err := io.ReadFull(rand.Reader, prefix); err != nil {
 		return nil, err
 	}
 
-	stream := cipher.NewCFBEncrypter(block, iv)
-	stream.XORKeyStream(ciphertext[aes.BlockSize:], plaintext)
+	if _, err := w.Write(header.Bytes()); err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(prefix); err != nil {
+		return nil, err
+	}
+
+	return &encryptWriter{
+		w:      w,
+		aead:   aead,
+		ad:     header.Bytes(),
+		prefix: prefix,
+		buf:    make([]byte, 0, envelopeChunkSize),
+	}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		c := copy(e.buf[len(e.buf):cap(e.buf)], p)
+		e.buf = e.buf[:len(e.buf)+c]
+		p = p[c:]
+
+		// hold a full chunk back until more arrives, it may be the last
+		if len(e.buf) == cap(e.buf) && len(p) > 0 {
+			if err := e.seal(false); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// Close seals the last chunk. It does not close the underlying writer.
+func (e *encryptWriter) Close() error {
+	return e.seal(true)
+}
+
+func (e *encryptWriter) seal(final bool) error {
+	if e.counter == ^uint32(0) {
+		return errors.New("encrypted store is too large")
+	}
+
+	ct := e.aead.Seal(nil, chunkNonce(e.prefix, e.counter, final), e.buf, e.ad)
+	size := uint32(len(ct))
+	if final {
+		size |= envelopeFinal
+	}
+
+	var l [4]byte
+	binary.BigEndian.PutUint32(l[:], size)
+	if _, err := e.w.Write(l[:]); err != nil {
+		return err
+	}
+
+	if _, err := e.w.Write(ct); err != nil {
+		return err
+	}
+
+	e.counter++
+	e.buf = e.buf[:0]
+	return nil
+}
+
+func chunkNonce(prefix []byte, counter uint32, final bool) []byte {
+	nonce := append([]byte{}, prefix...)
+	nonce = binary.BigEndian.AppendUint32(nonce, counter)
+	if final {
+		return append(nonce, 1)
+	}
+	return append(nonce, 0)
+}
+
+type decryptReader struct {
+	r       io.Reader
+	aead    cipher.AEAD
+	ad      []byte
+	prefix  []byte
+	counter uint32
+	buf     []byte
+	done    bool
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.buf) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+
+		if err := d.open(); err != nil {
+			return 0, err
+		}
+	}
 
-	return ciphertext, nil
+	n := copy(p, d.buf)
+	d.buf = d.buf[n:]
+	return n, nil
 }
 
-func decrypt(key string, ciphertext []byte) ([]byte, error) {
+func (d *decryptReader) open() error {
+	var l [4]byte
+	if _, err := io.ReadFull(d.r, l[:]); err != nil {
+		return ErrDecrypt
+	}
+
+	size := binary.BigEndian.Uint32(l[:])
+	final := size&envelopeFinal != 0
+	size &^= envelopeFinal
+	if size > envelopeChunkSize+uint32(d.aead.Overhead()) {
+		return ErrDecrypt
+	}
+
+	ct := make([]byte, size)
+	if _, err := io.ReadFull(d.r, ct); err != nil {
+		return ErrDecrypt
+	}
+
+	pt, err := d.aead.Open(nil, chunkNonce(d.prefix, d.counter, final), ct, d.ad)
+	if err != nil {
+		return ErrDecrypt
+	}
+
+	if final {
+		var b [1]byte
+		if n, _ := d.r.Read(b[:]); n > 0 {
+			return ErrDecrypt
+		}
+	}
+
+	d.counter++
+	d.buf = pt
+	d.done = final
+	return nil
+}
+
+// newDecryptReader reads a store encrypted in any envelope version, or
+// before envelopes existed. Only version 2 is decrypted as it is read, the
+// others are small enough to be read whole.
+func newDecryptReader(r io.Reader, passphrase string) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(envelopeMagic))
+	if err != nil || string(magic) != envelopeMagic {
+		data, err := io.ReadAll(br)
+		if err != nil {
+			return nil, err
+		}
+
+		pt, err := decryptLegacy(passphrase, data)
+		if err != nil {
+			return nil, err
+		}
+
+		if !bytes.HasPrefix(pt, []byte(storeHeader)) {
+			return nil, ErrDecrypt
+		}
+		return bytes.NewReader(pt), nil
+	}
+
+	header := make([]byte, len(envelopeMagic)+4+envelopeSaltSize)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, ErrDecrypt
+	}
+
+	params := header[len(envelopeMagic) : len(envelopeMagic)+4]
+	switch params[0] {
+	case envelopeVersion:
+		rest, err := io.ReadAll(br)
+		if err != nil {
+			return nil, err
+		}
+
+		pt, err := decrypt(passphrase, append(header, rest...))
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(pt), nil
+	case envelopeStreamVersion:
+		aead, err := newEnvelopeAEAD(passphrase, header[len(envelopeMagic)+4:], params[1], int(params[2]), int(params[3]))
+		if err != nil {
+			return nil, err
+		}
+
+		prefix := make([]byte, aead.NonceSize()-5)
+		if _, err := io.ReadFull(br, prefix); err != nil {
+			return nil, ErrDecrypt
+		}
+
+		return &decryptReader{
+			r:      br,
+			aead:   aead,
+			ad:     header,
+			prefix: prefix,
+		}, nil
+	default:
+		return nil, errors.New("unsupported encrypted store version")
+	}
+}
+
+// decrypt opens a version 1 envelope:
+//
+//	magic | version | log2(N) | r | p | salt | nonce | AES-256-GCM ciphertext
+func decrypt(passphrase string, ciphertext []byte) ([]byte, error) {
+	hl := len(envelopeMagic) + 4 + envelopeSaltSize
+	if len(ciphertext) < hl {
+		return nil, ErrDecrypt
+	}
+
+	params := ciphertext[len(envelopeMagic) : len(envelopeMagic)+4]
+	if params[0] != envelopeVersion {
+		return nil, errors.New("unsupported encrypted store version")
+	}
+
+	salt := ciphertext[len(envelopeMagic)+4 : hl]
+	aead, err := newEnvelopeAEAD(passphrase, salt, params[1], int(params[2]), int(params[3]))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < hl+aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+
+	nonce := ciphertext[hl : hl+aead.NonceSize()]
+	plaintext, err := aead.Open(nil, nonce, ciphertext[hl+aead.NonceSize():], ciphertext[:hl])
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+
+	return plaintext, nil
+}
+
+func newEnvelopeAEAD(passphrase string, salt []byte, logN byte, r, p int) (cipher.AEAD, error) {
+	// the parameters come from the file, so they are bounded to keep a
+	// crafted one from taking unbounded time and memory to open
+	if logN < 10 || logN > 20 || r < 1 || r > 32 || p < 1 || p > 16 {
+		return nil, errors.New("invalid encrypted store parameters")
+	}
+
+	key, err := scrypt.Key([]byte(passphrase), salt, 1<<logN, r, p, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// decryptLegacy reads stores written before the envelope format existed,
+// which used AES-CFB keyed by an unsalted SHA-256 of the passphrase.
+func decryptLegacy(key string, ciphertext []byte) ([]byte, error) {
 	sha := sha256.Sum256([]byte(key))
 	block, err := aes.NewCipher(sha[0:])
 	if err != nil {
@@ -47,3 +344,15 @@ func decrypt(key string, ciphertext []byte) ([]byte, error) {
 
 	return plaintext, nil
 }
+
+// countWriter counts the bytes written through it.
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
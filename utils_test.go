@@ -0,0 +1,181 @@
+package pindb
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"testing"
+)
+
+func encrypt(t *testing.T, passphrase string, data []byte) []byte {
+	t.Helper()
+
+	var b bytes.Buffer
+	e, err := newEncryptWriter(&b, passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func decryptAll(passphrase string, data []byte) ([]byte, error) {
+	r, err := newDecryptReader(bytes.NewReader(data), passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestEncryptedStoreRoundTrips(t *testing.T) {
+	s, b := newTestStore(t, NewMemoryBackend())
+
+	l, err := b.Add("link", mustParse(t, "https://example.com"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var data bytes.Buffer
+	if _, err := s.WriteEncryptedTo(&data, "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Contains(data.Bytes(), []byte(storeHeader)) {
+		t.Fatal("the store was written in the clear")
+	}
+
+	r, err := New().ReadEncryptedStream(bytes.NewReader(data.Bytes()), "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rb, err := r.Bucket(b.UUID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rb.Link(l.UUID()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEncryptRoundTripsChunks(t *testing.T) {
+	for _, n := range []int{0, envelopeChunkSize, 2*envelopeChunkSize + 1} {
+		data := make([]byte, n)
+		if _, err := rand.Read(data); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := decryptAll("secret", encrypt(t, "secret", data))
+		if err != nil {
+			t.Fatalf("%d bytes: %v", n, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("%d bytes: got %d bytes back", n, len(got))
+		}
+	}
+}
+
+func TestDecryptRejectsWrongPassphrases(t *testing.T) {
+	data := encrypt(t, "secret", []byte(storeHeader))
+
+	if _, err := decryptAll("wrong", data); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("got %v, want ErrDecrypt", err)
+	}
+}
+
+func TestDecryptRejectsTruncatedStreams(t *testing.T) {
+	plain := make([]byte, 2*envelopeChunkSize)
+	data := encrypt(t, "secret", plain)
+
+	// drop the last chunk, leaving whole chunks that still open
+	last := len(data) - (envelopeChunkSize + 16 + 4)
+	if _, err := decryptAll("secret", data[:last]); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("got %v for a truncated stream, want ErrDecrypt", err)
+	}
+
+	if _, err := decryptAll("secret", append(data, 0)); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("got %v for trailing data, want ErrDecrypt", err)
+	}
+}
+
+func TestDecryptRejectsCostlyParameters(t *testing.T) {
+	data := encrypt(t, "secret", []byte(storeHeader))
+
+	for i, v := range map[int]byte{1: 30, 2: 255, 3: 255} {
+		crafted := append([]byte{}, data...)
+		crafted[len(envelopeMagic)+i] = v
+
+		if _, err := decryptAll("secret", crafted); err == nil {
+			t.Errorf("opened a store with parameter %d set to %d", i, v)
+		}
+	}
+}
+
+func TestDecryptReadsVersion1(t *testing.T) {
+	plain := []byte(storeHeader + "v3\n")
+
+	salt := make([]byte, envelopeSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		t.Fatal(err)
+	}
+
+	aead, err := newEnvelopeAEAD("secret", salt, envelopeLogN, envelopeR, envelopeP)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := append([]byte(envelopeMagic), envelopeVersion, envelopeLogN, envelopeR, envelopeP)
+	header = append(header, salt...)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		t.Fatal(err)
+	}
+
+	data := append(append(append([]byte{}, header...), nonce...), aead.Seal(nil, nonce, plain, header)...)
+
+	got, err := decryptAll("secret", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, plain) {
+		t.Errorf("got %q, want %q", got, plain)
+	}
+}
+
+func TestDecryptReadsLegacyStores(t *testing.T) {
+	plain := []byte(storeHeader + "\nSN\u2063legacy\n")
+
+	key := sha256.Sum256([]byte("secret"))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := make([]byte, aes.BlockSize+len(plain))
+	if _, err := rand.Read(data[:aes.BlockSize]); err != nil {
+		t.Fatal(err)
+	}
+	cipher.NewCFBEncrypter(block, data[:aes.BlockSize]).XORKeyStream(data[aes.BlockSize:], plain)
+
+	got, err := decryptAll("secret", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, plain) {
+		t.Errorf("got %q, want %q", got, plain)
+	}
+
+	if _, err := decryptAll("wrong", data); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("got %v with the wrong passphrase, want ErrDecrypt", err)
+	}
+}
@@ -65,10 +65,20 @@ type Warning struct {
 	tag      Tag
 }
 
+func (w *Warning) Category() WarningCategory {
+	return w.category
+}
+
+func (w *Warning) Tag() Tag {
+	return w.tag
+}
+
 func (w *Warning) String() string {
 	switch true {
 	case w.category.MismatchRecord():
 		return "the link description record does not match data"
+	case w.category.NoUUID():
+		return "the link url has no pindbuuid"
 	case w.category.MismatchUUID():
 		return "the link uuid does not match the data"
 	case w.category.MultiplePinDBGroupTag():